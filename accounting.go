@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+)
+
+// watchUsage follows the stats stream of the running container, keeping its CPU time and
+// integrating its memory usage over time until the stream ends with the container
+func watchUsage(ctx context.Context, docker *docker_cli.Client, containerId string, result *runResult) {
+	resp, err := docker.ContainerStats(ctx, containerId, true)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	var last time.Time
+	var lastMemory uint64
+	for {
+		var stats docker_t.StatsJSON
+		if err := dec.Decode(&stats); err != nil {
+			return
+		}
+		if stats.Read.IsZero() {
+			continue
+		}
+		var byteSeconds float64
+		if !last.IsZero() {
+			byteSeconds = float64(lastMemory) * stats.Read.Sub(last).Seconds()
+		}
+		last, lastMemory = stats.Read, stats.MemoryStats.Usage
+		result.addUsage(time.Duration(stats.CPUStats.CPUUsage.TotalUsage), byteSeconds)
+	}
+}
+
+// addUsage records the cumulative CPU time and memory used since the previous sample
+func (r *runResult) addUsage(cpuTime time.Duration, memoryByteSeconds float64) {
+	r.usageMu.Lock()
+	defer r.usageMu.Unlock()
+	if cpuTime > r.cpuTime {
+		r.cpuTime = cpuTime
+	}
+	r.memoryByteSeconds += memoryByteSeconds
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cloudPollInterval is how often the state of a cloud job is checked
+const cloudPollInterval = 2 * time.Second
+
+const aciAPIVersion = "2021-10-01"
+
+// ACI needs resource requests, these are used without limits
+const (
+	aciDefaultCPUs     = 1.0
+	aciDefaultMemoryGB = 1.5
+)
+
+// azureToken gets a management API token with the service principal of AZURE_TENANT_ID,
+// AZURE_CLIENT_ID and AZURE_CLIENT_SECRET, as the SDKs' environment credential does
+func azureToken(ctx context.Context) (string, error) {
+	tenant, clientID, secret := os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID"), os.Getenv("AZURE_CLIENT_SECRET")
+	if tenant == "" || clientID == "" || secret == "" {
+		return "", errors.New("AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET must be set")
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {secret},
+		"scope":         {"https://management.azure.com/.default"},
+	}
+	return oauthToken(ctx, "https://login.microsoftonline.com/"+url.PathEscape(tenant)+"/oauth2/v2.0/token", form)
+}
+
+// oauthToken exchanges the form at an OAuth2 token endpoint for an access token
+func oauthToken(ctx context.Context, endpoint string, form url.Values) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", errors.Wrapf(err, "token request failed: %s", resp.Status)
+	}
+	if token.AccessToken == "" {
+		return "", errors.Errorf("token request failed: %s %s", token.Error, token.Description)
+	}
+	return token.AccessToken, nil
+}
+
+type aciContainerState struct {
+	State    string `json:"state"`
+	ExitCode *int   `json:"exitCode"`
+	Detail   string `json:"detailStatus"`
+}
+
+type aciContainerGroup struct {
+	Properties struct {
+		ProvisioningState string `json:"provisioningState"`
+		Containers        []struct {
+			Properties struct {
+				InstanceView struct {
+					CurrentState aciContainerState `json:"currentState"`
+				} `json:"instanceView"`
+			} `json:"properties"`
+		} `json:"containers"`
+	} `json:"properties"`
+}
+
+// imageEntrypoint looks up the entrypoint of the image with the local daemon
+func (r *Runner) imageEntrypoint(ctx context.Context, image string) ([]string, error) {
+	docker, err := r.newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer docker.Close()
+	inspect, _, err := docker.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	if inspect.Config == nil {
+		return nil, nil
+	}
+	return inspect.Config.Entrypoint, nil
+}
+
+// aciContainerGroupSpec maps the job onto a container group that is never restarted; ACI only
+// has a command, which replaces the entrypoint, so the entrypoint is prepended to the args
+func (r *Runner) aciContainerGroupSpec(job *backendJob, name string, entrypoint []string) map[string]interface{} {
+	var env []map[string]string
+	for k, v := range job.envMap() {
+		env = append(env, map[string]string{"name": k, "value": v})
+	}
+	cpus, memoryGB := aciDefaultCPUs, aciDefaultMemoryGB
+	if job.NanoCPUs > 0 {
+		cpus = float64(job.NanoCPUs) / 1e9
+	}
+	if job.MemoryBytes > 0 {
+		memoryGB = float64(job.MemoryBytes) / (1 << 30)
+	}
+	container := map[string]interface{}{
+		"image":                job.Image,
+		"environmentVariables": env,
+		"resources": map[string]interface{}{
+			"requests": map[string]interface{}{"cpu": cpus, "memoryInGB": memoryGB},
+		},
+	}
+	if len(job.Args) > 0 {
+		container["command"] = append(append([]string(nil), entrypoint...), job.Args...)
+	}
+	return map[string]interface{}{
+		"location": r.aciLocation,
+		"tags":     map[string]string{labelRunID: job.RunID},
+		"properties": map[string]interface{}{
+			"osType":        "Linux",
+			"restartPolicy": "Never",
+			"containers":    []map[string]interface{}{{"name": "job", "properties": container}},
+		},
+	}
+}
+
+// runACI runs the job as an Azure Container Instances container group; its output is
+// fetched once it terminated, ACI only streams it over an interactive attach
+func (r *Runner) runACI(ctx context.Context, job *backendJob, stdout io.Writer) (int, error) {
+	subscription := os.Getenv("AZURE_SUBSCRIPTION_ID")
+	if subscription == "" || r.aciResourceGroup == "" || r.aciLocation == "" {
+		return 0, errors.New("--backend aci needs AZURE_SUBSCRIPTION_ID, --aci-resource-group and --aci-location")
+	}
+	token, err := azureToken(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var entrypoint []string
+	if len(job.Args) > 0 {
+		if entrypoint, err = r.imageEntrypoint(ctx, job.Image); err != nil {
+			return 0, errors.Wrap(err, "--backend aci needs the image locally to keep its entrypoint with args")
+		}
+	}
+	header := http.Header{"Authorization": {"Bearer " + token}}
+	name := "runonce-" + job.RunID[:8]
+	groupURL := fmt.Sprintf("https://management.azure.com/subscriptions/%s/resourceGroups/%s/providers/Microsoft.ContainerInstance/containerGroups/%s",
+		url.PathEscape(subscription), url.PathEscape(r.aciResourceGroup), name)
+	query := "?api-version=" + aciAPIVersion
+
+	if err := apiRequest(ctx, http.DefaultClient, http.MethodPut, groupURL+query, header, r.aciContainerGroupSpec(job, name, entrypoint), nil); err != nil {
+		return 0, errors.Wrap(err, "cannot create container group")
+	}
+	r.log.Printf("created container group %s\n", name)
+	defer func() {
+		deleteCtx, cancel := context.WithTimeout(context.Background(), r.cleanupTimeout)
+		defer cancel()
+		if err := apiRequest(deleteCtx, http.DefaultClient, http.MethodDelete, groupURL+query, header, nil, nil); err != nil {
+			r.log.Printf("cannot delete container group %s: %v\n", name, err)
+		}
+	}()
+
+	var deadline <-chan time.Time
+	if job.Timeout > 0 {
+		deadline = time.After(job.Timeout)
+	}
+	for {
+		select {
+		case <-deadline:
+			return 0, errors.Wrapf(ErrTimeout, "run timeout of %s exceeded", r.formatDuration(job.Timeout))
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(cloudPollInterval):
+		}
+
+		var group aciContainerGroup
+		if err := apiRequest(ctx, http.DefaultClient, http.MethodGet, groupURL+query, header, nil, &group); err != nil {
+			return 0, err
+		}
+		if group.Properties.ProvisioningState == "Failed" {
+			return 0, errors.New("container group provisioning failed")
+		}
+		if len(group.Properties.Containers) == 0 {
+			continue
+		}
+		state := group.Properties.Containers[0].Properties.InstanceView.CurrentState
+		if state.State != "Terminated" {
+			continue
+		}
+
+		var logs struct {
+			Content string `json:"content"`
+		}
+		if err := apiRequest(ctx, http.DefaultClient, http.MethodGet, groupURL+"/containers/job/logs"+query, header, nil, &logs); err != nil {
+			r.log.Printf("cannot fetch container logs: %v\n", err)
+		}
+		_, _ = io.WriteString(stdout, logs.Content)
+
+		if state.ExitCode == nil {
+			return 0, errors.Errorf("container terminated without an exit code (%s)", state.Detail)
+		}
+		return *state.ExitCode, nil
+	}
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.aciResourceGroup, "aci-resource-group", "", "resource group for --backend aci container groups")
+	rootCmd.Flags().StringVar(&cliOptions.aciLocation, "aci-location", "", "Azure region for --backend aci container groups, e.g. westeurope")
+}
@@ -0,0 +1,8 @@
+package main
+
+import "net"
+
+// activatedConn is nil, there is no socket activation on Windows
+func activatedConn() (net.Conn, error) {
+	return nil, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/container"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var adoptCmd = &cobra.Command{
+	Use:   "adopt <container-id|run-id>",
+	Short: "supervise a running managed container left behind by a crashed instance",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runnerCommand((*Runner).adoptRun),
+}
+
+// findAdoptable resolves a container id or run id to a running managed container
+func findAdoptable(ctx context.Context, docker *docker_cli.Client, ref string) (docker_t.ContainerJSON, error) {
+	info, err := docker.ContainerInspect(ctx, ref)
+	if docker_cli.IsErrNotFound(err) {
+		containers, lerr := findManagedContainers(ctx, docker, false, map[string]string{labelRunID: ref})
+		if lerr != nil {
+			return info, lerr
+		}
+		jobId := ""
+		for _, c := range containers {
+			// sidecars have a role, the job container has none
+			if c.Labels[labelRole] == "" {
+				jobId = c.ID
+			}
+		}
+		if jobId == "" {
+			return info, errors.Errorf("no running container found for '%s'", ref)
+		}
+		info, err = docker.ContainerInspect(ctx, jobId)
+	}
+	if err != nil {
+		return info, err
+	}
+	if info.Config.Labels[labelManaged] != "true" {
+		return info, errors.Errorf("container %s is not managed by docker-runonce", info.ID)
+	}
+	if !info.State.Running {
+		return info, errors.Errorf("container %s is not running", info.ID)
+	}
+	return info, nil
+}
+
+func (r *Runner) adoptRun(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	docker, err := r.newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer docker.Close()
+
+	info, err := findAdoptable(ctx, docker, args[0])
+	if err != nil {
+		return err
+	}
+	containerId, runID := info.ID, info.Config.Labels[labelRunID]
+	r.log.Printf("adopting container %s of run %s\n", containerId, runID)
+
+	// the original timeout still counts from the container's start
+	timeoutSpec := r.adoptTimeout
+	if !r.changed("timeout") {
+		timeoutSpec = info.Config.Labels[labelTimeout]
+	}
+	var timeoutCh <-chan time.Time
+	if timeoutSpec != "" {
+		d, err := parseTimeout(timeoutSpec)
+		if err != nil {
+			return errors.Wrapf(err, "invalid timeout '%s'", timeoutSpec)
+		}
+		if d > 0 {
+			startedAt, err := time.Parse(time.RFC3339Nano, info.State.StartedAt)
+			if err != nil {
+				return errors.Wrap(err, "invalid container start time")
+			}
+			timeoutCh = time.After(time.Until(startedAt.Add(d)))
+		}
+	}
+
+	waitCh, waitErrCh := docker.ContainerWait(ctx, containerId, container.WaitConditionNotRunning)
+	att, err := r.attachContainer(ctx, docker, containerId, false, os.Stdout, os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer att.Close()
+	defer r.cleanupAdopted(docker, info)
+
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signalCh)
+
+	for {
+		select {
+		case result := <-waitCh:
+			select {
+			case <-att.closedCh:
+			case <-time.After(drainTimeout):
+			}
+			if result.Error != nil {
+				return errors.Errorf("waiting for container failed: %s", result.Error.Message)
+			}
+			code := int(result.StatusCode)
+			if hostCode, ok := r.exitCodeMap[code]; ok {
+				code = hostCode
+			}
+			if code != 0 {
+				return &exitCodeError{code: code}
+			}
+			return nil
+		case err := <-waitErrCh:
+			return errors.Wrap(err, "waiting for container failed")
+		case <-timeoutCh:
+			r.log.Println("timeout reached, stopping container")
+			if err := docker.ContainerStop(ctx, containerId, nil); err != nil {
+				return err
+			}
+			return errors.Wrapf(ErrTimeout, "run timeout of %s exceeded", timeoutSpec)
+		case sig := <-signalCh:
+			r.log.Printf("received signal %s, stopping container\n", sig)
+			if err := docker.ContainerStop(ctx, containerId, nil); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// cleanupAdopted removes the containers of the adopted run and the network and workspace created for it
+func (r *Runner) cleanupAdopted(docker *docker_cli.Client, info docker_t.ContainerJSON) {
+	runID := info.Config.Labels[labelRunID]
+	if runID == "" {
+		r.cleanupContainer(docker, info.ID)
+		return
+	}
+	r.removeRunContainers(docker, runID)
+	if len(runID) < 8 {
+		return
+	}
+	if string(info.HostConfig.NetworkMode) == "runonce-"+runID[:8] {
+		r.removeNetwork(docker, string(info.HostConfig.NetworkMode))
+	}
+	for _, m := range info.Mounts {
+		if m.Name == "runonce-ws-"+runID[:8] {
+			r.removeWorkspace(docker, m.Name)
+		}
+	}
+}
+
+func init() {
+	adoptCmd.Flags().StringVar(&cliOptions.adoptTimeout, "timeout", "", "timeout counted from the container's start (default: the timeout the run was created with)")
+	rootCmd.AddCommand(adoptCmd)
+}
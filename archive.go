@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	docker_cli "docker.io/go-docker"
+	"github.com/mkke/go-docker/responses"
+	"github.com/mkke/go-mlog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var saveCmd = &cobra.Command{
+	Use:   "save <image>... -o <file>",
+	Short: "save images to a tarball for hosts without registry access",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runnerCommand((*Runner).saveImages),
+}
+
+func (r *Runner) saveImages(cmd *cobra.Command, images []string) error {
+	if r.saveOutput == "" {
+		return errors.New("no output file, use -o")
+	}
+	docker, err := r.newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer docker.Close()
+
+	ctx := context.Background()
+	for _, image := range images {
+		if err := r.pullImage(ctx, docker, image); err != nil {
+			return err
+		}
+	}
+	tarball, err := docker.ImageSave(ctx, images)
+	if err != nil {
+		return err
+	}
+	defer tarball.Close()
+
+	// written next to the target first, so a failed save leaves no truncated tarball
+	tmp, err := ioutil.TempFile(filepath.Dir(r.saveOutput), ".save-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, tarball); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "cannot save images")
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.saveOutput)
+}
+
+// loadImages loads a tarball written by save into the daemon
+func (r *Runner) loadImages(ctx context.Context, docker *docker_cli.Client, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dlog := mlog.WithPrefix("Docker", r.log)
+	if r.verbosity >= verboseInfo {
+		dlog.Printf("loading %s", path)
+	}
+	resp, err := docker.ImageLoad(ctx, f, true)
+	if err != nil {
+		return errors.Wrapf(err, "cannot load '%s'", path)
+	}
+	defer closeOnCancel(ctx, resp.Body)()
+	if err := responses.ParseStreamBody(resp.Body, dlog); err != nil {
+		if ctx.Err() != nil {
+			return errors.Wrapf(ctx.Err(), "load of '%s' aborted", path)
+		}
+		return err
+	}
+	return nil
+}
+
+func init() {
+	saveCmd.Flags().StringVarP(&cliOptions.saveOutput, "output", "o", "", "tarball to write")
+	rootCmd.Flags().StringVar(&cliOptions.loadImage, "load", "", "load images from a tarball written by save instead of pulling")
+	rootCmd.AddCommand(saveCmd)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"github.com/mkke/go-docker/attach"
+)
+
+// attachment bundles a hijacked attach connection with the handler copying its streams
+type attachment struct {
+	hr       docker_t.HijackedResponse
+	ah       *attach.Handler
+	closedCh chan struct{}
+	close    sync.Once
+	stdin    *stdinCopy
+}
+
+// attachContainer attaches to the container's output streams, replaying its log from the start.
+// Stdin is only attached on the first attach: with StdinOnce the daemon closes the container's stdin
+// as soon as the first attached client goes away, so there is nothing to re-attach to later.
+// Stdin is copied by a stdinCopy rather than the handler, to follow its flow.
+func (r *Runner) attachContainer(ctx context.Context, docker *docker_cli.Client, containerId string, withStdin bool,
+	stdout, stderr io.Writer) (*attachment, error) {
+
+	hr, err := docker.ContainerAttach(ctx, containerId, docker_t.ContainerAttachOptions{
+		Stream: true,
+		Stdin:  withStdin,
+		Stdout: true,
+		Stderr: true,
+		Logs:   true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ah := attach.NewHandler(hr).WithStdout(stdout).WithStderr(stderr)
+	a := &attachment{hr: hr, ah: ah, closedCh: make(chan struct{})}
+	ah.AddCloseListener(a.closedCh)
+	ah.Start()
+	if withStdin {
+		a.stdin = r.startStdinCopy(hr)
+	}
+	return a, nil
+}
+
+func (a *attachment) Close() {
+	a.close.Do(func() {
+		a.ah.Close()
+		a.hr.Close()
+	})
+}
+
+// containerRunning reports whether the container is still running; inspection errors count as not running
+func containerRunning(ctx context.Context, docker *docker_cli.Client, containerId string) bool {
+	info, err := docker.ContainerInspect(ctx, containerId)
+	if err != nil || info.ContainerJSONBase == nil || info.State == nil {
+		return false
+	}
+	return info.State.Running
+}
+
+// replayWriter forwards to w and counts what has been written, so that a replayed stream
+// can skip the part already forwarded before a Rewind.
+type replayWriter struct {
+	w       io.Writer
+	mu      sync.Mutex
+	written int64
+	skip    int64
+}
+
+func (rw *replayWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	n := len(p)
+	if rw.skip > 0 {
+		if int64(len(p)) <= rw.skip {
+			rw.skip -= int64(len(p))
+			return n, nil
+		}
+		p = p[rw.skip:]
+		rw.skip = 0
+	}
+
+	m, err := rw.w.Write(p)
+	rw.written += int64(m)
+	if err != nil {
+		return n - len(p) + m, err
+	}
+	return n, nil
+}
+
+// Rewind makes the writer expect the stream to be replayed from the beginning
+func (rw *replayWriter) Rewind() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.skip = rw.written
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// attestationTypes maps --require-attestation names to cosign's type and the in-toto predicate type it must carry
+var attestationTypes = map[string]struct{ cosignType, predicateType string }{
+	"slsa-provenance": {"slsaprovenance", "https://slsa.dev/provenance/"},
+	"spdx":            {"spdxjson", "https://spdx.dev/Document"},
+	"cyclonedx":       {"cyclonedx", "https://cyclonedx.org/bom"},
+}
+
+func (r *Runner) checkAttestationOptions() error {
+	if len(r.requireAttestation) == 0 {
+		return nil
+	}
+	for _, name := range r.requireAttestation {
+		if _, ok := attestationTypes[name]; !ok {
+			return errors.Errorf("invalid --require-attestation value '%s', expected slsa-provenance, spdx or cyclonedx", name)
+		}
+	}
+	if (r.attestationKey == "") == (r.attestationIdentity == "") {
+		return errors.New("--require-attestation needs either --attestation-key or --attestation-identity")
+	}
+	if r.attestationIdentity != "" && r.attestationIssuer == "" {
+		return errors.New("--attestation-identity needs --attestation-issuer")
+	}
+	return nil
+}
+
+// verifyAttestations checks with cosign that the registry holds signed attestations of
+// every required type for the digest; a local image without a registry digest cannot be verified
+func (r *Runner) verifyAttestations(ctx context.Context, image string, repoDigests []string) error {
+	if len(repoDigests) == 0 {
+		return errors.Wrapf(ErrPolicyDenied, "image '%s' has no registry digest to verify attestations of", image)
+	}
+	if _, err := exec.LookPath("cosign"); err != nil {
+		return errors.New("--require-attestation needs cosign on PATH")
+	}
+	ref := repoDigests[0]
+
+	for _, name := range r.requireAttestation {
+		t := attestationTypes[name]
+		args := []string{"verify-attestation", "--type", t.cosignType}
+		if r.attestationKey != "" {
+			args = append(args, "--key", r.attestationKey)
+		} else {
+			args = append(args, "--certificate-identity", r.attestationIdentity, "--certificate-oidc-issuer", r.attestationIssuer)
+		}
+		cmd := exec.CommandContext(ctx, "cosign", append(args, ref)...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			if _, ok := err.(*exec.ExitError); ok {
+				return errors.Wrapf(ErrPolicyDenied, "no valid %s attestation for '%s': %s", name, ref, lastLine(stderr.String()))
+			}
+			return err
+		}
+		if !hasPredicate(out, t.predicateType) {
+			return errors.Wrapf(ErrPolicyDenied, "no %s attestation for '%s'", name, ref)
+		}
+		r.log.Printf("verified %s attestation of %s\n", name, ref)
+	}
+	return nil
+}
+
+// hasPredicate reports whether one of the DSSE envelopes cosign printed holds a statement of the predicate type
+func hasPredicate(out []byte, predicateType string) bool {
+	envelopes := bufio.NewScanner(bytes.NewReader(out))
+	envelopes.Buffer(nil, 16<<20)
+	for envelopes.Scan() {
+		var envelope struct {
+			Payload string `json:"payload"`
+		}
+		if json.Unmarshal(envelopes.Bytes(), &envelope) != nil {
+			continue
+		}
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			continue
+		}
+		var statement struct {
+			PredicateType string `json:"predicateType"`
+		}
+		if json.Unmarshal(payload, &statement) == nil && strings.HasPrefix(statement.PredicateType, predicateType) {
+			return true
+		}
+	}
+	return false
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
+
+func init() {
+	rootCmd.Flags().StringSliceVar(&cliOptions.requireAttestation, "require-attestation", nil, "refuse images without a signed attestation of this type in the registry: slsa-provenance, spdx or cyclonedx (verified with cosign)")
+	rootCmd.Flags().StringVar(&cliOptions.attestationKey, "attestation-key", "", "public key the attestations must be signed with")
+	rootCmd.Flags().StringVar(&cliOptions.attestationIdentity, "attestation-identity", "", "certificate identity of keyless signed attestations")
+	rootCmd.Flags().StringVar(&cliOptions.attestationIssuer, "attestation-issuer", "", "OIDC issuer of keyless signed attestations")
+}
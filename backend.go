@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	docker_t "docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/container"
+	"github.com/pkg/errors"
+)
+
+// backendJob is a run as handed to a scheduler backend
+type backendJob struct {
+	RunID       string
+	Image       string
+	Args        []string
+	Env         []string
+	MemoryBytes uint64
+	NanoCPUs    int64
+	Timeout     time.Duration
+}
+
+// newBackendJob builds the spec from the run options and checks it against the policy;
+// host-relative limits need a local daemon
+func (r *Runner) newBackendJob(runID string, args []string) (*backendJob, error) {
+	if isHostRelative(r.memoryLimit) || isHostRelative(r.cpus) {
+		return nil, errors.Errorf("--backend %s needs absolute resource limits", r.backendName)
+	}
+	memoryBytes, err := parseMemorySize(r.memoryLimit, &docker_t.Info{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid memory limit '%s'", r.memoryLimit)
+	}
+	nanoCPUs, err := parseCPUs(r.cpus, &docker_t.Info{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid cpus '%s'", r.cpus)
+	}
+	runTimeout, err := parseTimeout(r.timeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid run timeout")
+	}
+	// backends mount nothing of the host, which leaves the image and the limits to check
+	policy, err := loadPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.check(r.imageName, "", &container.HostConfig{
+		Resources: container.Resources{Memory: int64(memoryBytes), NanoCPUs: nanoCPUs},
+	}); err != nil {
+		return nil, err
+	}
+	return &backendJob{
+		RunID:       runID,
+		Image:       r.imageName,
+		Args:        args,
+		Env:         append(r.envVars, "RUNONCE_RUN_ID="+runID),
+		MemoryBytes: memoryBytes,
+		NanoCPUs:    nanoCPUs,
+		Timeout:     runTimeout,
+	}, nil
+}
+
+// envMap resolves the NAME=value and NAME entries of the environment like docker run -e
+func (j *backendJob) envMap() map[string]string {
+	env := make(map[string]string)
+	for _, e := range j.Env {
+		if i := strings.Index(e, "="); i > 0 {
+			env[e[:i]] = e[i+1:]
+		} else if v, ok := os.LookupEnv(e); ok {
+			env[e] = v
+		}
+	}
+	return env
+}
+
+// apiOpen sends a request with a JSON body, if given, and returns the response of a successful one
+func apiOpen(ctx context.Context, client *http.Client, method, rawURL string, header http.Header, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, rawURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, errors.Errorf("%s %s: %s: %s", method, req.URL.Path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// apiRequest sends a request like apiOpen and decodes the JSON response into out, if given
+func apiRequest(ctx context.Context, client *http.Client, method, rawURL string, header http.Header, body, out interface{}) error {
+	resp, err := apiOpen(ctx, client, method, rawURL, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// runOnBackend runs the job on the --backend scheduler instead of the Docker daemon
+func (r *Runner) runOnBackend(runID string, args []string) (err error) {
+	spec, err := r.newBackendJob(runID, args)
+	if err != nil {
+		return err
+	}
+	codeMap, err := parseExitCodeMap(r.exitCodeMappings)
+	if err != nil {
+		return err
+	}
+
+	result := &runResult{RunID: runID, Image: spec.Image, Args: args, Start: time.Now()}
+	result.Host, _ = os.Hostname()
+	defer func() { r.finishRun(result, err) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signalCh)
+	go func() {
+		select {
+		case sig := <-signalCh:
+			r.log.Printf("received signal %s\n", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var exitCode int
+	switch r.backendName {
+	case "nomad":
+		exitCode, err = r.runNomad(ctx, spec, os.Stdout, os.Stderr)
+	case "aci":
+		exitCode, err = r.runACI(ctx, spec, os.Stdout)
+	case "cloudrun":
+		exitCode, err = r.runCloudRun(ctx, spec)
+	default:
+		return errors.Errorf("invalid --backend value '%s'", r.backendName)
+	}
+	if errors.Is(err, ErrTimeout) {
+		result.TimedOut = true
+	}
+	if err != nil {
+		return err
+	}
+	if hostCode, ok := codeMap[exitCode]; ok {
+		exitCode = hostCode
+	}
+	if exitCode != 0 {
+		return &exitCodeError{code: exitCode}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.backendName, "backend", "docker", "where to run the job: docker, nomad, aci or cloudrun; credentials come from the usual environment variables")
+}
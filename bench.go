@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/container"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench <image> [-- args...]",
+	Short: "measure the startup latency of an image",
+	Long: `bench runs the image repeatedly and reports percentiles of the time to pull the cached image,
+create and start the container, and receive its first output.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runnerCommand((*Runner).benchImage),
+}
+
+// benchPhases are the measured phases in the order of a run
+var benchPhases = []string{"pull-hit", "create", "start", "first-output", "total"}
+
+// benchRun measures one run; first-output is counted from the start request
+func (r *Runner) benchRun(ctx context.Context, docker *docker_cli.Client, image string, args []string,
+	resources container.Resources) (map[string]time.Duration, error) {
+	d := make(map[string]time.Duration)
+	begin := time.Now()
+
+	if err := r.pullImage(ctx, docker, image); err != nil {
+		return nil, err
+	}
+	d["pull-hit"] = time.Since(begin)
+
+	t := time.Now()
+	runID := newRunID()
+	resp, err := r.createContainer(ctx, docker, image, &container.Config{
+		Image:        image,
+		Cmd:          args,
+		AttachStdout: true,
+		AttachStderr: true,
+		Labels:       r.managedLabels(runID, image, args),
+	}, &container.HostConfig{Resources: resources}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer r.cleanupContainer(docker, resp.ID)
+	d["create"] = time.Since(t)
+
+	hr, err := docker.ContainerAttach(ctx, resp.ID, docker_t.ContainerAttachOptions{Stream: true, Stdout: true, Stderr: true})
+	if err != nil {
+		return nil, err
+	}
+	defer hr.Close()
+	waitCh, waitErrCh := docker.ContainerWait(ctx, resp.ID, container.WaitConditionNextExit)
+
+	t = time.Now()
+	if err := docker.ContainerStart(ctx, resp.ID, docker_t.ContainerStartOptions{}); err != nil {
+		return nil, err
+	}
+	d["start"] = time.Since(t)
+
+	// the multiplexed stream starts with a frame header, so any byte is output
+	firstCh := make(chan time.Duration, 1)
+	go func() {
+		var b [1]byte
+		if _, err := hr.Reader.Read(b[:]); err == nil {
+			firstCh <- time.Since(t)
+		}
+		close(firstCh)
+		_, _ = io.Copy(ioutil.Discard, hr.Reader)
+	}()
+
+	select {
+	case <-waitCh:
+	case err := <-waitErrCh:
+		return nil, err
+	}
+	select {
+	case first, ok := <-firstCh:
+		if ok {
+			d["first-output"] = first
+		}
+	case <-time.After(drainTimeout):
+	}
+	d["total"] = time.Since(begin)
+	return d, nil
+}
+
+// percentile of sorted durations, nearest rank
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func (r *Runner) benchImage(cmd *cobra.Command, args []string) error {
+	if r.benchRuns < 1 {
+		return errors.New("--runs must be at least 1")
+	}
+	docker, err := r.newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer docker.Close()
+
+	ctx := context.Background()
+	image := args[0]
+	// the first pull may be a miss, which is not what is measured
+	if err := r.pullImage(ctx, docker, image); err != nil {
+		return err
+	}
+
+	// containers get the limits of a run, which the policy may require
+	hostInfo, err := docker.Info(ctx)
+	if err != nil {
+		return err
+	}
+	memoryLimitBytes, err := parseMemorySize(r.memoryLimit, &hostInfo)
+	if err != nil {
+		return errors.Wrapf(err, "invalid memory limit '%s'", r.memoryLimit)
+	}
+	nanoCPUs, err := parseCPUs(r.cpus, &hostInfo)
+	if err != nil {
+		return errors.Wrapf(err, "invalid cpus '%s'", r.cpus)
+	}
+	resources := container.Resources{Memory: int64(memoryLimitBytes), NanoCPUs: nanoCPUs}
+
+	samples := make(map[string][]time.Duration)
+	for i := 0; i < r.benchRuns; i++ {
+		d, err := r.benchRun(ctx, docker, image, args[1:], resources)
+		if err != nil {
+			return errors.Wrapf(err, "run %d", i+1)
+		}
+		for phase, v := range d {
+			samples[phase] = append(samples[phase], v)
+		}
+	}
+
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tMIN\tP50\tP90\tP99\tMAX")
+	for _, phase := range benchPhases {
+		s := samples[phase]
+		if len(s) == 0 {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t-\n", phase)
+			continue
+		}
+		sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", phase, r.formatDuration(s[0]),
+			r.formatDuration(percentile(s, 0.5)), r.formatDuration(percentile(s, 0.9)),
+			r.formatDuration(percentile(s, 0.99)), r.formatDuration(s[len(s)-1]))
+	}
+	return tw.Flush()
+}
+
+func init() {
+	benchCmd.Flags().IntVar(&cliOptions.benchRuns, "runs", 10, "number of runs to measure")
+	rootCmd.AddCommand(benchCmd)
+}
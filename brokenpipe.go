@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// brokenPipeWriter notices when the reader of w went away; later writes are discarded,
+// so the attach stream keeps draining until the run is stopped
+type brokenPipeWriter struct {
+	w      io.Writer
+	once   sync.Once
+	broken chan struct{}
+}
+
+func newBrokenPipeWriter(w io.Writer) *brokenPipeWriter {
+	// without this, the runtime exits on SIGPIPE as soon as stdout breaks, leaving the container behind
+	signal.Ignore(syscall.SIGPIPE)
+	return &brokenPipeWriter{w: w, broken: make(chan struct{})}
+}
+
+func (bw *brokenPipeWriter) Write(p []byte) (int, error) {
+	select {
+	case <-bw.broken:
+		return len(p), nil
+	default:
+	}
+	n, err := bw.w.Write(p)
+	if errors.Is(err, syscall.EPIPE) {
+		bw.once.Do(func() { close(bw.broken) })
+		return len(p), nil
+	}
+	return n, err
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+// captureFile writes container output to a file, optionally gzip-compressed and rotated
+// by size or age; rotated files get a timestamp before the extension (out-20060102T150405.log.gz),
+// and a sequence number after it if that name is taken (out-20060102T150405-1.log.gz)
+type captureFile struct {
+	mu       sync.Mutex
+	path     string
+	compress bool
+	maxSize  int64
+	interval time.Duration
+
+	f       *os.File
+	w       io.WriteCloser
+	written int64
+	opened  time.Time
+}
+
+func (r *Runner) openCaptureFile(path string) (*captureFile, error) {
+	c := &captureFile{path: path, interval: r.rotateInterval}
+	switch r.compressOutput {
+	case "":
+	case "gzip":
+		c.compress = true
+	case "zstd":
+		return nil, errors.New("zstd compression is not supported, use gzip")
+	default:
+		return nil, errors.Errorf("invalid --compress value '%s'", r.compressOutput)
+	}
+	if r.rotateSize != "" {
+		size, err := humanize.ParseBytes(r.rotateSize)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid --rotate-size '%s'", r.rotateSize)
+		}
+		c.maxSize = int64(size)
+	}
+	return c, c.open()
+}
+
+func (c *captureFile) open() error {
+	f, err := os.OpenFile(c.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	c.f, c.w, c.written, c.opened = f, f, 0, time.Now()
+	if c.compress {
+		c.w = gzip.NewWriter(f)
+	}
+	return nil
+}
+
+func (c *captureFile) close() error {
+	if c.w != c.f {
+		if err := c.w.Close(); err != nil {
+			c.f.Close()
+			return err
+		}
+	}
+	return c.f.Close()
+}
+
+func (c *captureFile) rotate() error {
+	if err := c.close(); err != nil {
+		return err
+	}
+	name := c.path
+	ext := filepath.Ext(name)
+	if c.compress && ext == ".gz" {
+		ext = filepath.Ext(strings.TrimSuffix(name, ext)) + ext
+	}
+	base := strings.TrimSuffix(name, ext) + "-" + time.Now().Format("20060102T150405")
+	rotated := base + ext
+	// rotations within the same second would otherwise replace each other
+	for seq := 1; ; seq++ {
+		if _, err := os.Lstat(rotated); os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return err
+		}
+		rotated = base + "-" + strconv.Itoa(seq) + ext
+	}
+	if err := os.Rename(name, rotated); err != nil {
+		return err
+	}
+	return c.open()
+}
+
+func (c *captureFile) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.written > 0 && ((c.maxSize > 0 && c.written+int64(len(p)) > c.maxSize) ||
+		(c.interval > 0 && time.Since(c.opened) >= c.interval)) {
+		if err := c.rotate(); err != nil {
+			return 0, errors.Wrap(err, "cannot rotate output file")
+		}
+	}
+	n, err := c.w.Write(p)
+	c.written += int64(n)
+	return n, err
+}
+
+func (c *captureFile) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.close()
+}
+
+// outputTarget returns the file output goes to instead of def, and a function closing it
+func (r *Runner) outputTarget(path string, def io.Writer) (io.Writer, func(), error) {
+	if path == "" {
+		return def, func() {}, nil
+	}
+	c, err := r.openCaptureFile(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot open output file")
+	}
+	return c, func() {
+		if err := c.Close(); err != nil {
+			r.log.Printf("cannot close %s: %v\n", path, err)
+		}
+	}, nil
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.stdoutFile, "stdout-file", "", "write the container's stdout to this file instead of stdout")
+	rootCmd.Flags().StringVar(&cliOptions.stderrFile, "stderr-file", "", "write the container's stderr to this file instead of stderr")
+	rootCmd.Flags().StringVar(&cliOptions.compressOutput, "compress", "", "compress the output files: gzip")
+	rootCmd.Flags().StringVar(&cliOptions.rotateSize, "rotate-size", "", "start a new output file when it reaches this size, e.g. 100Mi")
+	rootCmd.Flags().DurationVar(&cliOptions.rotateInterval, "rotate-interval", 0, "start a new output file after this time")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCaptureFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.log")
+	r := newRunner(options{rotateSize: "4"})
+	c, err := r.openCaptureFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each write after the first rotates, all within the same second
+	for _, line := range []string{"aaa\n", "bbb\n", "ccc\n", "ddd\n"} {
+		if _, err := c.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "out*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content string
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content += string(data)
+	}
+	if len(files) != 4 || len(content) != 16 {
+		t.Errorf("got %d files with %q, want all output in 4 files", len(files), content)
+	}
+}
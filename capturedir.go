@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	"github.com/pkg/errors"
+)
+
+// captureDirTimeout limits copying the captured directories out of the container
+const captureDirTimeout = 10 * time.Minute
+
+// captureDir is a container directory copied to a host directory after the run
+type captureDir struct {
+	container string
+	host      string
+}
+
+// parseCaptureDirs parses container-path=>host-dir specs
+func parseCaptureDirs(specs []string) ([]captureDir, error) {
+	var dirs []captureDir
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=>", 2)
+		if len(parts) != 2 || !path.IsAbs(parts[0]) || parts[1] == "" {
+			return nil, errors.Errorf("invalid --capture-dir '%s', expected /container/path=>host-dir", spec)
+		}
+		dirs = append(dirs, captureDir{container: path.Clean(parts[0]), host: parts[1]})
+	}
+	return dirs, nil
+}
+
+// copyCaptureDirs copies the contents of each directory of the exited container into a
+// subdirectory of its host directory named by the start time and run id
+func (r *Runner) copyCaptureDirs(docker *docker_cli.Client, containerId string, dirs []captureDir, runID string, start time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), captureDirTimeout)
+	defer cancel()
+	for _, d := range dirs {
+		target := filepath.Join(d.host, start.Format("20060102T150405")+"-"+runID[:8])
+		if err := r.copyCaptureDir(ctx, docker, containerId, d.container, target); err != nil {
+			r.log.Printf("cannot capture %s: %v\n", d.container, err)
+			continue
+		}
+		r.log.Printf("captured %s to %s\n", d.container, target)
+	}
+}
+
+func (r *Runner) copyCaptureDir(ctx context.Context, docker *docker_cli.Client, containerId, src, target string) error {
+	content, _, err := docker.CopyFromContainer(ctx, containerId, src)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(content)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		// entries are below the copied directory's base name, which is dropped
+		name := hdr.Name
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[i+1:]
+		} else {
+			name = ""
+		}
+		name = path.Clean("/" + name)
+		if name == "/" {
+			continue
+		}
+		dest := filepath.Join(target, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			// links could point outside the target
+			r.log.Printf("not capturing %s, only files and directories are\n", path.Join(src, name))
+		}
+	}
+}
+
+func init() {
+	rootCmd.Flags().StringArrayVar(&cliOptions.captureDirSpecs, "capture-dir", nil, "copy a container directory to a new timestamped subdirectory of the host directory after the run, /container/out=>./results (repeatable)")
+}
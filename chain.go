@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var chainCmd = &cobra.Command{
+	Use:   "chain <job-file>",
+	Short: "run the steps of a job file in order, sharing a workspace volume",
+	Long: `chain runs the images of a YAML job file one after the other:
+
+  workspace: /workspace     # where the shared volume is mounted in every step
+  steps:
+    - name: build
+      image: golang:1.15
+      args: [go, build, ./...]
+      env: [CGO_ENABLED=0]
+      timeout: 10m
+      on-failure: abort     # or continue with the next step
+
+The chain fails with the exit code of the last failed step.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runnerCommand((*Runner).runChain),
+}
+
+type chainStep struct {
+	Name      string   `yaml:"name"`
+	Image     string   `yaml:"image"`
+	Args      []string `yaml:"args"`
+	Env       []string `yaml:"env"`
+	Timeout   string   `yaml:"timeout"`
+	OnFailure string   `yaml:"on-failure"`
+}
+
+type chainJob struct {
+	Workspace string      `yaml:"workspace"`
+	Steps     []chainStep `yaml:"steps"`
+}
+
+func loadChainJob(path string) (*chainJob, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	job := &chainJob{Workspace: "/workspace"}
+	if err := yaml.Unmarshal(data, job); err != nil {
+		return nil, errors.Wrapf(err, "invalid job file '%s'", path)
+	}
+	if len(job.Steps) == 0 {
+		return nil, errors.Errorf("job file '%s' has no steps", path)
+	}
+	for i, step := range job.Steps {
+		if step.Image == "" {
+			return nil, errors.Errorf("step %d has no image", i+1)
+		}
+		switch step.OnFailure {
+		case "", "abort", "continue":
+		default:
+			return nil, errors.Errorf("invalid on-failure '%s' in step %d", step.OnFailure, i+1)
+		}
+		if step.Name == "" {
+			job.Steps[i].Name = step.Image
+		}
+	}
+	return job, nil
+}
+
+// stepArgs are the command line running a step with the workspace mounted
+func (s chainStep) stepArgs(volume, workspace string) []string {
+	args := []string{"--image", s.Image, "--volume", volume + ":" + workspace}
+	if s.Timeout != "" {
+		args = append(args, "--timeout", s.Timeout)
+	}
+	for _, env := range s.Env {
+		args = append(args, "--env", env)
+	}
+	return append(append(args, "--"), s.Args...)
+}
+
+func (r *Runner) runChain(cmd *cobra.Command, args []string) error {
+	job, err := loadChainJob(args[0])
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	docker, err := r.newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer docker.Close()
+
+	runID := newRunID()
+	vol, err := createWorkspace(context.Background(), docker, "runonce-chain-"+runID[:8], runID)
+	if err != nil {
+		return err
+	}
+	defer r.removeWorkspace(docker, vol)
+
+	// the running step handles signals itself; the chain only stops starting new ones
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	exitCode := 0
+	for i, step := range job.Steps {
+		select {
+		case sig := <-sigCh:
+			return errors.Errorf("received signal %s, chain stopped before step %s", sig, step.Name)
+		default:
+		}
+
+		r.log.Printf("step %d/%d: %s\n", i+1, len(job.Steps), step.Name)
+		c := exec.Command(exe, step.stepArgs(vol, job.Workspace)...)
+		c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := c.Run(); err != nil {
+			if _, ok := err.(*exec.ExitError); !ok {
+				return errors.Wrapf(err, "cannot run step %s", step.Name)
+			}
+		}
+		if code := c.ProcessState.ExitCode(); code != 0 {
+			exitCode = code
+			if step.OnFailure != "continue" {
+				r.log.Printf("step %s failed with %d, aborting\n", step.Name, code)
+				return &exitCodeError{code: code}
+			}
+			r.log.Printf("step %s failed with %d, continuing\n", step.Name, code)
+		}
+	}
+	if exitCode != 0 {
+		return &exitCodeError{code: exitCode}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(chainCmd)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"github.com/pkg/errors"
+)
+
+// checkCleanupOptions validates the cleanup flags; --keep-on-error is --rm=on-success
+func (r *Runner) checkCleanupOptions(rmChanged bool) error {
+	if r.keepOnError {
+		if rmChanged && r.rmMode != "on-success" {
+			return errors.New("--keep-on-error and --rm are mutually exclusive")
+		}
+		r.rmMode = "on-success"
+	}
+	switch r.rmMode {
+	case "always", "on-success", "never":
+	default:
+		return errors.Errorf("invalid --rm value '%s'", r.rmMode)
+	}
+	switch r.cleanupMode {
+	case "stop", "kill":
+	default:
+		return errors.Errorf("invalid --cleanup value '%s'", r.cleanupMode)
+	}
+	return nil
+}
+
+// keepContainer reports whether --rm keeps the container of a run that ended with err
+func (r *Runner) keepContainer(err error) bool {
+	switch r.rmMode {
+	case "never":
+		return true
+	case "on-success":
+		return err != nil
+	}
+	return false
+}
+
+// cleanupContainer removes a container, stopping it gracefully first with --cleanup=stop;
+// a container that is already gone counts as removed
+func (r *Runner) cleanupContainer(docker *docker_cli.Client, containerId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cleanupTimeout)
+	defer cancel()
+	if r.cleanupMode == "stop" {
+		// the daemon applies the stop timeout the container was created with
+		_ = docker.ContainerStop(ctx, containerId, nil)
+	}
+	err := docker.ContainerRemove(ctx, containerId, docker_t.ContainerRemoveOptions{
+		Force: true,
+		// anonymous volumes, as of --capture-dir, go with the container like with AutoRemove
+		RemoveVolumes: true,
+	})
+	if docker_cli.IsErrNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.rmMode, "rm", "always", "when to remove the container: always, on-success or never")
+	rootCmd.Flags().StringVar(&cliOptions.cleanupMode, "cleanup", "kill", "how to remove a container that still runs: stop gracefully or kill")
+	rootCmd.PersistentFlags().DurationVar(&cliOptions.cleanupTimeout, "cleanup-timeout", 5*time.Second, "how long removing containers may take")
+}
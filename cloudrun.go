@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	cloudRunAPI   = "https://run.googleapis.com/v2/"
+	googleScope   = "https://www.googleapis.com/auth/cloud-platform"
+	metadataToken = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// googleServiceAccount is the part of a service account key file needed to get a token
+type googleServiceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// googleToken gets a token for the service account key of GOOGLE_APPLICATION_CREDENTIALS,
+// or from the metadata server when running on Google Cloud; it also returns the key's project
+func googleToken(ctx context.Context) (string, string, error) {
+	keyFile := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if keyFile == "" {
+		var token struct {
+			AccessToken string `json:"access_token"`
+		}
+		header := http.Header{"Metadata-Flavor": {"Google"}}
+		if err := apiRequest(ctx, http.DefaultClient, http.MethodGet, metadataToken, header, nil, &token); err != nil {
+			return "", "", errors.Wrap(err, "GOOGLE_APPLICATION_CREDENTIALS is not set and the metadata server is not available")
+		}
+		return token.AccessToken, "", nil
+	}
+
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return "", "", err
+	}
+	var sa googleServiceAccount
+	if err := json.Unmarshal(data, &sa); err != nil {
+		return "", "", errors.Wrapf(err, "invalid service account key '%s'", keyFile)
+	}
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return "", "", errors.Errorf("no private key in '%s'", keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", "", err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", "", errors.Errorf("private key in '%s' is not an RSA key", keyFile)
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   sa.ClientEmail,
+		"scope": googleScope,
+		"aud":   sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)},
+	}
+	token, err := oauthToken(ctx, sa.TokenURI, form)
+	return token, sa.ProjectID, err
+}
+
+// cloudRunJobSpec maps the job onto a Cloud Run job with a single task that is not retried
+func cloudRunJobSpec(job *backendJob) map[string]interface{} {
+	var env []map[string]string
+	for k, v := range job.envMap() {
+		env = append(env, map[string]string{"name": k, "value": v})
+	}
+	limits := map[string]string{}
+	if job.NanoCPUs > 0 {
+		limits["cpu"] = strconv.FormatFloat(float64(job.NanoCPUs)/1e9, 'f', -1, 64)
+	}
+	if job.MemoryBytes > 0 {
+		limits["memory"] = fmt.Sprintf("%dMi", (job.MemoryBytes+1<<20-1)>>20)
+	}
+	container := map[string]interface{}{
+		"image":     job.Image,
+		"env":       env,
+		"resources": map[string]interface{}{"limits": limits},
+	}
+	if len(job.Args) > 0 {
+		container["args"] = job.Args
+	}
+	task := map[string]interface{}{
+		"containers": []map[string]interface{}{container},
+		"maxRetries": 0,
+	}
+	if job.Timeout > 0 {
+		task["timeout"] = strconv.FormatInt(int64(job.Timeout.Seconds()+0.5), 10) + "s"
+	}
+	return map[string]interface{}{
+		"labels":   map[string]string{"docker-runonce-run-id": job.RunID},
+		"template": map[string]interface{}{"taskCount": 1, "template": task},
+	}
+}
+
+type googleOperation struct {
+	Name     string          `json:"name"`
+	Done     bool            `json:"done"`
+	Metadata json.RawMessage `json:"metadata"`
+	Error    *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// waitOperation polls a long-running operation until it is done
+func waitOperation(ctx context.Context, header http.Header, op googleOperation) (googleOperation, error) {
+	for !op.Done {
+		select {
+		case <-ctx.Done():
+			return op, ctx.Err()
+		case <-time.After(cloudPollInterval):
+		}
+		if err := apiRequest(ctx, http.DefaultClient, http.MethodGet, cloudRunAPI+op.Name, header, nil, &op); err != nil {
+			return op, err
+		}
+	}
+	if op.Error != nil {
+		return op, errors.New(op.Error.Message)
+	}
+	return op, nil
+}
+
+// runCloudRun runs the job as a Cloud Run job execution; its output goes to Cloud Logging,
+// whose link is logged
+func (r *Runner) runCloudRun(ctx context.Context, job *backendJob) (int, error) {
+	token, keyProject, err := googleToken(ctx)
+	if err != nil {
+		return 0, err
+	}
+	project := r.cloudRunProject
+	if project == "" {
+		if project = os.Getenv("GOOGLE_CLOUD_PROJECT"); project == "" {
+			project = keyProject
+		}
+	}
+	if project == "" || r.cloudRunRegion == "" {
+		return 0, errors.New("--backend cloudrun needs a project (--cloudrun-project or GOOGLE_CLOUD_PROJECT) and --cloudrun-region")
+	}
+	header := http.Header{"Authorization": {"Bearer " + token}}
+	jobID := "runonce-" + job.RunID[:8]
+	parent := fmt.Sprintf("projects/%s/locations/%s", project, r.cloudRunRegion)
+	jobName := parent + "/jobs/" + jobID
+
+	var op googleOperation
+	if err := apiRequest(ctx, http.DefaultClient, http.MethodPost, cloudRunAPI+parent+"/jobs?jobId="+jobID, header, cloudRunJobSpec(job), &op); err != nil {
+		return 0, errors.Wrap(err, "cannot create job")
+	}
+	defer func() {
+		deleteCtx, cancel := context.WithTimeout(context.Background(), r.cleanupTimeout)
+		defer cancel()
+		if err := apiRequest(deleteCtx, http.DefaultClient, http.MethodDelete, cloudRunAPI+jobName, header, nil, nil); err != nil {
+			r.log.Printf("cannot delete job %s: %v\n", jobID, err)
+		}
+	}()
+	if _, err := waitOperation(ctx, header, op); err != nil {
+		return 0, errors.Wrap(err, "cannot create job")
+	}
+	r.log.Printf("created cloud run job %s\n", jobID)
+
+	if err := apiRequest(ctx, http.DefaultClient, http.MethodPost, cloudRunAPI+jobName+":run", header, map[string]interface{}{}, &op); err != nil {
+		return 0, errors.Wrap(err, "cannot run job")
+	}
+	var execution struct {
+		Name   string `json:"name"`
+		LogURI string `json:"logUri"`
+	}
+	if err := json.Unmarshal(op.Metadata, &execution); err != nil || execution.Name == "" {
+		return 0, errors.New("cannot run job: no execution in the response")
+	}
+	if execution.LogURI != "" {
+		r.log.Printf("output of execution %s: %s\n", execution.Name, execution.LogURI)
+	}
+
+	runCtx := ctx
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+	}
+	if _, err := waitOperation(runCtx, header, op); err != nil {
+		if runCtx.Err() != nil {
+			// a running execution keeps the job from being deleted
+			r.cancelExecution(header, execution.Name)
+		}
+		if runCtx.Err() == context.DeadlineExceeded {
+			return 0, errors.Wrapf(ErrTimeout, "run timeout of %s exceeded", r.formatDuration(job.Timeout))
+		}
+		// a failed task also fails the operation, its exit code is still reported below
+		if ctx.Err() != nil {
+			return 0, err
+		}
+	}
+
+	var tasks struct {
+		Tasks []struct {
+			LastAttemptResult *struct {
+				ExitCode int `json:"exitCode"`
+				Status   struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				} `json:"status"`
+			} `json:"lastAttemptResult"`
+		} `json:"tasks"`
+	}
+	if err := apiRequest(ctx, http.DefaultClient, http.MethodGet, cloudRunAPI+execution.Name+"/tasks", header, nil, &tasks); err != nil {
+		return 0, err
+	}
+	if len(tasks.Tasks) == 0 || tasks.Tasks[0].LastAttemptResult == nil {
+		return 0, errors.New("execution ended without a task result")
+	}
+	result := tasks.Tasks[0].LastAttemptResult
+	// tasks that failed without exiting, e.g. on their timeout, only have a status
+	if result.ExitCode == 0 && result.Status.Code != 0 {
+		return 0, errors.Errorf("task failed: %s", result.Status.Message)
+	}
+	return result.ExitCode, nil
+}
+
+// cancelExecution stops a running execution and waits for it to end, within the cleanup timeout
+func (r *Runner) cancelExecution(header http.Header, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cleanupTimeout)
+	defer cancel()
+	var op googleOperation
+	err := apiRequest(ctx, http.DefaultClient, http.MethodPost, cloudRunAPI+name+":cancel", header, map[string]interface{}{}, &op)
+	if err == nil {
+		_, err = waitOperation(ctx, header, op)
+	}
+	if err != nil {
+		r.log.Printf("cannot cancel execution %s: %v\n", name, err)
+	}
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.cloudRunProject, "cloudrun-project", "", "Google Cloud project for --backend cloudrun (default: GOOGLE_CLOUD_PROJECT or the key's project)")
+	rootCmd.Flags().StringVar(&cliOptions.cloudRunRegion, "cloudrun-region", "", "region for --backend cloudrun jobs, e.g. europe-west1")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// runConfig is the contents of the config file
+type runConfig struct {
+	Profiles   map[string]profile `yaml:"profiles"`
+	Registries []registryRule     `yaml:"registries"`
+	SMTP       smtpConfig         `yaml:"smtp"`
+}
+
+// registryRule pulls images matching From from To instead; a trailing * in both carries the
+// rest of the reference over, e.g. docker.io/* -> mirror.internal/*
+type registryRule struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// profile is a named set of options; empty fields leave the corresponding option alone
+type profile struct {
+	Image       string   `yaml:"image"`
+	Args        []string `yaml:"args"`
+	Env         []string `yaml:"env"`
+	Mounts      []string `yaml:"mounts"`
+	MemoryLimit string   `yaml:"memory-limit"`
+	CPUs        string   `yaml:"cpus"`
+	Timeout     string   `yaml:"timeout"`
+
+	Notify *notifyConfig `yaml:"notify"`
+}
+
+// rewriteReference applies the first matching rule to the normalized image reference;
+// rules without * match the repository and keep the tag
+func rewriteReference(rules []registryRule, image string) (string, bool) {
+	ref := normalizeReference(image)
+	repo, tag := ref, ""
+	if i := strings.Index(ref, "@"); i >= 0 {
+		repo, tag = ref[:i], ref[i:]
+	} else if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		repo, tag = ref[:i], ref[i:]
+	}
+	for _, rule := range rules {
+		if strings.HasSuffix(rule.From, "*") {
+			if prefix := strings.TrimSuffix(rule.From, "*"); strings.HasPrefix(ref, prefix) {
+				return strings.TrimSuffix(rule.To, "*") + strings.TrimPrefix(ref, prefix), true
+			}
+		} else if repo == normalizeReference(rule.From) {
+			return rule.To + tag, true
+		}
+	}
+	return "", false
+}
+
+var profilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "list the profiles of the config file",
+	Args:  cobra.NoArgs,
+	RunE:  runnerCommand((*Runner).listProfiles),
+}
+
+func defaultConfigPath() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "docker-runonce", "config.yaml")
+}
+
+// loadConfig reads the config file; a missing file is an empty config
+func (r *Runner) loadConfig() (*runConfig, error) {
+	var cfg runConfig
+	data, err := ioutil.ReadFile(r.configPath)
+	if os.IsNotExist(err) {
+		return &cfg, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.Wrapf(err, "invalid config file '%s'", r.configPath)
+	}
+	return &cfg, nil
+}
+
+// applyProfile sets options from the selected profile unless they were given on the command line
+func (r *Runner) applyProfile(args []string) ([]string, error) {
+	cfg, err := r.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	p, ok := cfg.Profiles[r.profileName]
+	if !ok {
+		return nil, errors.Errorf("unknown profile '%s'", r.profileName)
+	}
+
+	setString := func(flag string, target *string, value string) {
+		if value != "" && !r.changed(flag) {
+			*target = value
+		}
+	}
+	setString("image", &r.imageName, p.Image)
+	setString("memory-limit", &r.memoryLimit, p.MemoryLimit)
+	setString("cpus", &r.cpus, p.CPUs)
+	setString("timeout", &r.timeout, p.Timeout)
+	if p.Notify != nil {
+		if err := p.Notify.validate(r.resultFuncs()); err != nil {
+			return nil, errors.Wrapf(err, "profile '%s'", r.profileName)
+		}
+		r.profileNotify = p.Notify
+	}
+
+	// list options add to what was given on the command line
+	r.envVars = append(p.Env, r.envVars...)
+	r.volumeBinds = append(p.Mounts, r.volumeBinds...)
+
+	if len(args) == 0 {
+		args = p.Args
+	}
+	return args, nil
+}
+
+func (r *Runner) listProfiles(cmd *cobra.Command, args []string) error {
+	cfg, err := r.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROFILE\tIMAGE\tARGS")
+	for _, name := range names {
+		p := cfg.Profiles[name]
+		fmt.Fprintf(tw, "%s\t%s\t%q\n", name, p.Image, p.Args)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&cliOptions.configPath, "config", defaultConfigPath(), "config file")
+	rootCmd.Flags().StringVar(&cliOptions.profileName, "profile", "", "apply a named profile of the config file")
+	rootCmd.AddCommand(profilesCmd)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	"docker.io/go-docker/api/types/container"
+	"github.com/pkg/errors"
+)
+
+// conflictLookupTimeout bounds how long to look for the container of a running instance,
+// which may still be pulling or creating it
+const conflictLookupTimeout = 30 * time.Second
+
+// attachRunning attaches to the output of the running container of another instance,
+// found by its labels, and returns its exit status as our own
+func (r *Runner) attachRunning(ctx context.Context, docker *docker_cli.Client, labels map[string]string) error {
+	lookupCtx, cancelLookup := context.WithTimeout(ctx, conflictLookupTimeout)
+	defer cancelLookup()
+
+	var containerId string
+	for containerId == "" {
+		containers, err := findManagedContainers(lookupCtx, docker, false, labels)
+		if err != nil {
+			return err
+		}
+		if len(containers) > 0 {
+			containerId = containers[0].ID
+			break
+		}
+
+		select {
+		case <-time.After(time.Second):
+		case <-lookupCtx.Done():
+			return errors.New("another instance is already running, but its container could not be found")
+		}
+	}
+
+	r.log.Printf("another instance is already running, attaching to container %s\n", containerId)
+
+	// the other instance may keep its container on error, so don't wait for removal
+
+	waitCh, waitErrCh := docker.ContainerWait(ctx, containerId, container.WaitConditionNextExit)
+
+	prefix := outputPrefix(r.outputPrefixFormat, containerId, r.colorOutput)
+	att, err := r.attachContainer(ctx, docker, containerId, false,
+		wrapOutput(os.Stdout, prefix, r.timestamps), wrapOutput(os.Stderr, prefix, r.timestamps))
+	if err != nil {
+		return err
+	}
+	defer att.Close()
+
+	select {
+	case result := <-waitCh:
+		select {
+		case <-att.closedCh:
+		case <-time.After(drainTimeout):
+		}
+		if result.Error != nil {
+			return errors.Errorf("waiting for container failed: %s", result.Error.Message)
+		}
+		code := int(result.StatusCode)
+		if hostCode, ok := r.exitCodeMap[code]; ok {
+			code = hostCode
+		}
+		if code != 0 {
+			return &exitCodeError{code: code}
+		}
+		return nil
+	case err := <-waitErrCh:
+		return errors.Wrap(err, "waiting for container failed")
+	}
+}
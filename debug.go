@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+)
+
+// debugRun is what /debug/run reports about a run
+type debugRun struct {
+	sync.Mutex
+	RunID       string    `json:"runId"`
+	Image       string    `json:"image"`
+	ContainerID string    `json:"containerId,omitempty"`
+	Phase       string    `json:"phase"`
+	Since       time.Time `json:"since"`
+}
+
+// setDebugPhase records what the run is doing, e.g. while it seems to hang
+func (r *Runner) setDebugPhase(phase string) {
+	r.debug.Lock()
+	defer r.debug.Unlock()
+	r.debug.Phase, r.debug.Since = phase, time.Now()
+}
+
+func (r *Runner) setDebugContainer(containerId string) {
+	r.debug.Lock()
+	defer r.debug.Unlock()
+	r.debug.ContainerID = containerId
+}
+
+func (r *Runner) serveRunState(w http.ResponseWriter, req *http.Request) {
+	r.debug.Lock()
+	data, err := json.MarshalIndent(&r.debug, "", "  ")
+	r.debug.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// startDebugServer serves net/http/pprof and the state of the run on --debug-listen until closed;
+// a fallback run serves its own state on the same address once the first attempt has closed it
+func (r *Runner) startDebugServer(runID, image string) (io.Closer, error) {
+	r.debug.Lock()
+	r.debug.RunID, r.debug.Image = runID, image
+	r.debug.Unlock()
+	l, err := net.Listen("tcp", r.debugListen)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/run", r.serveRunState)
+	srv := &http.Server{Handler: mux}
+	r.log.Printf("debug endpoints on http://%s/debug/pprof/ and /debug/run\n", l.Addr())
+	go func() { _ = srv.Serve(l) }()
+	return srv, nil
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.debugListen, "debug-listen", "", "serve pprof and the run state on this address, e.g. 127.0.0.1:6060")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	docker_cli "docker.io/go-docker"
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+// daemonFreeSpace returns the free space of the daemon's data root: measured for a local daemon,
+// otherwise as reported by storage drivers that do (devicemapper). ok is false if it is unknown.
+func (r *Runner) daemonFreeSpace(ctx context.Context, docker *docker_cli.Client) (free uint64, ok bool, err error) {
+	info, err := docker.Info(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	if r.daemonIsLocal() && info.DockerRootDir != "" {
+		if free, err := freeSpace(info.DockerRootDir); err == nil {
+			return free, true, nil
+		}
+	}
+	for _, status := range info.DriverStatus {
+		if status[0] == "Data Space Available" {
+			free, err := humanize.ParseBytes(strings.Replace(status[1], " ", "", -1))
+			return free, err == nil, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// checkFreeSpace fails if the daemon has less free space than --min-free-space
+func (r *Runner) checkFreeSpace(ctx context.Context, docker *docker_cli.Client) error {
+	required, err := humanize.ParseBytes(r.minFreeSpace)
+	if err != nil {
+		return errors.Wrapf(err, "invalid --min-free-space '%s'", r.minFreeSpace)
+	}
+	free, ok, err := r.daemonFreeSpace(ctx, docker)
+	if err != nil {
+		return errors.Wrap(err, "cannot query daemon disk space")
+	}
+	if !ok {
+		if r.verbosity >= verboseInfo {
+			r.log.Println("free space of the daemon's data root is unknown, skipping the check")
+		}
+		return nil
+	}
+	if free < required {
+		return errors.Errorf("only %s free in the daemon's data root, %s required", r.formatBytes(free), r.formatBytes(required))
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.minFreeSpace, "min-free-space", "", "fail before pulling if the daemon's data root has less free space, e.g. 2G")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	"docker.io/go-docker/api"
+	docker_t "docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/versions"
+	"github.com/docker/go-connections/sockets"
+	"github.com/docker/go-connections/tlsconfig"
+	"github.com/mkke/go-mlog"
+	"github.com/pkg/errors"
+)
+
+// newDockerClient creates a client configured from the environment like docker_cli.NewEnvClient,
+// with the daemon selected by setDaemonEnv and API call tracing when running at trace verbosity.
+func (r *Runner) newDockerClient() (*docker_cli.Client, error) {
+	host := r.getenv("DOCKER_HOST")
+	if host == "" {
+		host = docker_cli.DefaultDockerHost
+	}
+	proto, addr, _, err := docker_cli.ParseHost(host)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{}
+	if err := sockets.ConfigureTransport(transport, proto, addr); err != nil {
+		return nil, err
+	}
+	if certPath := r.getenv("DOCKER_CERT_PATH"); certPath != "" {
+		tlsConfig, err := tlsconfig.Client(tlsconfig.Options{
+			CAFile:             filepath.Join(certPath, "ca.pem"),
+			CertFile:           filepath.Join(certPath, "cert.pem"),
+			KeyFile:            filepath.Join(certPath, "key.pem"),
+			InsecureSkipVerify: r.getenv("DOCKER_TLS_VERIFY") == "",
+		})
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	version := r.getenv("DOCKER_API_VERSION")
+	if version == "" {
+		version = api.DefaultVersion
+	}
+
+	if r.verbosity < verboseTrace {
+		return docker_cli.NewClient(host, version, &http.Client{Transport: transport}, nil)
+	}
+	return docker_cli.NewClient(host, version, &http.Client{Transport: &tracingTransport{
+		next: transport,
+		log:  mlog.WithPrefix("API", r.log),
+	}}, nil)
+}
+
+// daemonIsLocal reports whether the daemon is reached via a local unix socket,
+// so that its host can be inspected directly
+func (r *Runner) daemonIsLocal() bool {
+	host := r.getenv("DOCKER_HOST")
+	return host == "" || strings.HasPrefix(host, "unix://")
+}
+
+// hostUsesCgroupV2 reports whether a local daemon runs on a unified cgroup hierarchy.
+// The daemon Info of this API version does not report the cgroup version.
+func (r *Runner) hostUsesCgroupV2() bool {
+	if !r.daemonIsLocal() {
+		return false
+	}
+	_, err := os.Stat("/sys/fs/cgroup/cgroup.controllers")
+	return err == nil
+}
+
+// waitRemovedVersion is the API version from which a wait honours its condition; before, it returns
+// at the exit, and an AutoRemove may take the container while its exit status is being read
+const waitRemovedVersion = "1.30"
+
+// supportsWaitRemoved reports whether the client and daemon agree on an API version that can wait
+// for the removal of a container
+func supportsWaitRemoved(docker *docker_cli.Client, ping docker_t.Ping) bool {
+	version := docker.ClientVersion()
+	if ping.APIVersion != "" && versions.LessThan(ping.APIVersion, version) {
+		version = ping.APIVersion
+	}
+	return versions.GreaterThanOrEqualTo(version, waitRemovedVersion)
+}
+
+// tracingTransport logs every Docker API request with its outcome and duration.
+// Hijacked attach connections bypass the transport and are not traced.
+type tracingTransport struct {
+	next http.RoundTripper
+	log  printfLogger
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	duration := time.Since(start)
+	if err != nil {
+		t.log.Printf("%s %s failed after %s: %v\n", req.Method, req.URL.RequestURI(), duration, err)
+		return nil, err
+	}
+	t.log.Printf("%s %s -> %s (%s)\n", req.Method, req.URL.RequestURI(), resp.Status, duration)
+	return resp, nil
+}
+
+// reconnectContainer waits up to --daemon-reconnect-timeout for the daemon to answer again and
+// returns the container's state then
+func (r *Runner) reconnectContainer(ctx context.Context, docker *docker_cli.Client, containerId string) (docker_t.ContainerJSON, error) {
+	deadline := time.Now().Add(r.reconnectTimeout)
+	for {
+		if _, err := docker.Ping(ctx); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			return docker_t.ContainerJSON{}, errors.Wrap(err, "daemon did not return")
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return docker_t.ContainerJSON{}, ctx.Err()
+		}
+	}
+	info, err := docker.ContainerInspect(ctx, containerId)
+	if err != nil {
+		return info, errors.Wrap(err, "container lost with the daemon restart, its exit status is unknown")
+	}
+	if info.ContainerJSONBase == nil || info.State == nil {
+		return info, errors.New("container state unknown after daemon restart")
+	}
+	return info, nil
+}
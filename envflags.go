@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envFlagPrefix names the environment variables that set flags: --memory-limit is RUNONCE_MEMORY_LIMIT.
+// Precedence is command line, then environment, then profile, then image labels, then defaults.
+const envFlagPrefix = "RUNONCE_"
+
+func envFlagName(flag string) string {
+	return envFlagPrefix + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// applyEnvFlags sets all flags not given on the command line from the environment;
+// repeatable flags take one value per line
+func applyEnvFlags(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "help" {
+			return
+		}
+		value, ok := os.LookupEnv(envFlagName(f.Name))
+		if !ok {
+			return
+		}
+		values := []string{value}
+		if t := f.Value.Type(); strings.HasSuffix(t, "Array") || strings.HasSuffix(t, "Slice") {
+			values = strings.Split(strings.TrimRight(value, "\n"), "\n")
+		}
+		for _, v := range values {
+			if serr := flags.Set(f.Name, v); serr != nil {
+				err = errors.Wrapf(serr, "invalid %s", envFlagName(f.Name))
+				return
+			}
+		}
+	})
+	return err
+}
+
+func init() {
+	rootCmd.PersistentPreRunE = applyEnvFlags
+}
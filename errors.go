@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	docker_cli "docker.io/go-docker"
+	"github.com/pkg/errors"
+)
+
+// failure causes that callers can branch on; each maps to its own process exit code
+var (
+	ErrImageNotFound = errors.New("image not found")
+	ErrLockHeld      = errors.New("another instance is already running")
+	ErrTimeout       = errors.New("run timed out")
+	ErrOOMKilled     = errors.New("container ran out of memory")
+	ErrPullDenied    = errors.New("image pull denied")
+	ErrPolicyDenied  = errors.New("denied by policy")
+	ErrCPUTimeLimit  = errors.New("container exceeded its cpu time limit")
+	ErrBrokenPipe    = errors.New("stdout was closed")
+	ErrCreateWarned  = errors.New("the daemon warned about the container configuration")
+	ErrOutsideWindow = errors.New("outside of the time window")
+	ErrCancelled     = errors.New("run was cancelled")
+)
+
+// errorExitCodes follow sysexits.h where it has a fitting code, and timeout(1) and the
+// shell's "cannot execute" and signal conventions otherwise
+var errorExitCodes = []struct {
+	err  error
+	code int
+}{
+	{ErrImageNotFound, 66}, // EX_NOINPUT
+	{ErrLockHeld, 75},      // EX_TEMPFAIL
+	{ErrOutsideWindow, 75}, // EX_TEMPFAIL
+	{ErrPullDenied, 77},    // EX_NOPERM
+	{ErrCreateWarned, 78},  // EX_CONFIG
+	{ErrPolicyDenied, 126}, // command cannot execute
+	{ErrTimeout, 124},
+	{ErrOOMKilled, 137},
+	{ErrCPUTimeLimit, 152}, // SIGXCPU
+	{ErrBrokenPipe, 141},   // SIGPIPE
+	{ErrCancelled, 143},    // SIGTERM, also for an interrupt, a gone parent or a broker cancel
+}
+
+// errorExitCode returns the exit code for errors with a known cause
+func errorExitCode(err error) (int, bool) {
+	for _, e := range errorExitCodes {
+		if errors.Is(err, e.err) {
+			return e.code, true
+		}
+	}
+	return 0, false
+}
+
+// classifyPullError marks registry authorization failures, which the daemon reports as plain messages
+func classifyPullError(err error) error {
+	msg := strings.ToLower(err.Error())
+	if docker_cli.IsErrUnauthorized(err) || strings.Contains(msg, "denied") || strings.Contains(msg, "unauthorized") {
+		return errors.Wrap(ErrPullDenied, err.Error())
+	}
+	return err
+}
+
+// parseExitCodeMap parses container=host pairs; each spec may hold several separated by commas
+func parseExitCodeMap(specs []string) (map[int]int, error) {
+	m := map[int]int{}
+	for _, spec := range specs {
+		for _, pair := range strings.Split(spec, ",") {
+			parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(parts) != 2 {
+				return nil, errors.Errorf("invalid exit code mapping '%s', expected container=host", pair)
+			}
+			from, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return nil, errors.Errorf("invalid exit code mapping '%s', expected container=host", pair)
+			}
+			to, err := strconv.Atoi(parts[1])
+			if err != nil || to < 0 || to > 255 {
+				return nil, errors.Errorf("invalid exit code mapping '%s', host code must be 0-255", pair)
+			}
+			m[from] = to
+		}
+	}
+	return m, nil
+}
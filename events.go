@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/filters"
+)
+
+// runEvent is one NDJSON line of the --events-json stream
+type runEvent struct {
+	Time        time.Time `json:"time"`
+	Event       string    `json:"event"`
+	Image       string    `json:"image,omitempty"`
+	ContainerID string    `json:"containerId,omitempty"`
+	ExitCode    *int      `json:"exitCode,omitempty"`
+	Message     string    `json:"message,omitempty"`
+}
+
+// eventSink writes lifecycle events as NDJSON; a nil sink discards them
+type eventSink struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	enc *json.Encoder
+}
+
+// openEventSink opens the --events-json target, either "fd:N" or a file path
+func openEventSink(target string) (*eventSink, error) {
+	var w io.WriteCloser
+	if strings.HasPrefix(target, "fd:") {
+		fd, err := strconv.Atoi(strings.TrimPrefix(target, "fd:"))
+		if err != nil {
+			return nil, err
+		}
+		w = os.NewFile(uintptr(fd), target)
+	} else {
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return &eventSink{w: w, enc: json.NewEncoder(w)}, nil
+}
+
+func (s *eventSink) emit(ev runEvent) {
+	if s == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.enc.Encode(ev)
+}
+
+func (s *eventSink) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.w.Close()
+}
+
+// watchContainerEvents records the daemon's die, kill, oom and health events of the container;
+// OOM kills in particular are not visible in the exit status alone
+func (r *Runner) watchContainerEvents(ctx context.Context, docker *docker_cli.Client, containerId string, result *runResult) {
+	eventFilters := filters.NewArgs()
+	eventFilters.Add("container", containerId)
+	for _, action := range []string{"oom", "die", "kill", "health_status"} {
+		eventFilters.Add("event", action)
+	}
+	msgCh, errCh := docker.Events(ctx, docker_t.EventsOptions{Filters: eventFilters})
+
+	for {
+		select {
+		case msg := <-msgCh:
+			e := daemonEvent{
+				Time:     time.Unix(0, msg.TimeNano),
+				Action:   msg.Action,
+				Signal:   msg.Actor.Attributes["signal"],
+				ExitCode: msg.Actor.Attributes["exitCode"],
+			}
+			result.addDaemonEvent(e)
+			switch {
+			case msg.Action == "oom":
+				r.log.Println("container ran out of memory")
+				result.markOOM()
+				r.runEvents.emit(runEvent{Event: "oom", ContainerID: containerId})
+			case msg.Action == "kill":
+				r.log.Printf("container was sent signal %s\n", e.Signal)
+			case msg.Action == "die" && r.verbosity >= verboseInfo:
+				r.log.Printf("container died with exit code %s\n", e.ExitCode)
+			case strings.HasPrefix(msg.Action, "health_status"):
+				r.log.Printf("container %s\n", strings.Replace(msg.Action, "_", " ", 1))
+			}
+		case <-errCh:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import "github.com/pkg/errors"
+
+// infrastructureError marks failures to get the job running at all, as opposed to failures of the job
+type infrastructureError struct {
+	error
+}
+
+func (e infrastructureError) Unwrap() error { return e.error }
+
+// runtimeExitCodes are what runtimes and shells exit with when the command cannot be run
+var runtimeExitCodes = map[int]bool{125: true, 126: true, 127: true}
+
+func isInfrastructureError(err error) bool {
+	var infraErr infrastructureError
+	if errors.As(err, &infraErr) {
+		return true
+	}
+	var exitErr *exitCodeError
+	return errors.As(err, &exitErr) && runtimeExitCodes[exitErr.code]
+}
+
+// fallsBack reports whether a run ending in err is run again with the --fallback-image;
+// fanned out and remote runs fall back on their own
+func (r *Runner) fallsBack(err error) bool {
+	return err != nil && r.fallbackImage != "" && !r.fallbackAttempt && !(len(r.daemonHosts) > 0 && r.pickStrategy == "") &&
+		r.remoteAddr == "" && isInfrastructureError(err)
+}
+
+// runWithFallback runs again with --fallback-image if the run with the image failed for
+// infrastructure reasons, with the options as given. Stdin already forwarded to the failed run
+// is not sent again. Only the fallback run is reported.
+func (r *Runner) runWithFallback(args []string) error {
+	// the run changes its options when applying the job file, the profile and image label options
+	opts, stdin := r.options, r.containerStdin
+	err := r.run(args)
+	if !r.fallsBack(err) {
+		return err
+	}
+	fallback := newRunner(opts)
+	fallback.flags, fallback.containerStdin = r.flags, stdin
+	fallback.imageName, fallback.fallbackAttempt = r.fallbackImage, true
+	return fallback.run(args)
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.fallbackImage, "fallback-image", "", "image to run instead if the image cannot be pulled or started, e.g. repo:stable")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"github.com/pkg/errors"
+)
+
+// fileArgsDir is where files of @path arguments are placed in the container
+const fileArgsDir = "/.runonce-files"
+
+// fileArg is a host file referenced by an argument, uploaded as name below fileArgsDir
+type fileArg struct {
+	name string
+	data []byte
+	mode os.FileMode
+}
+
+// expandFileArgs replaces @path arguments naming a host file, and @- for stdin, with the path of
+// their upload in the container; other arguments starting with @ are kept, @@ escapes a literal @
+func (r *Runner) expandFileArgs(args []string) ([]string, []fileArg, bool, error) {
+	if !r.fileArgs {
+		return args, nil, false, nil
+	}
+	var expanded []string
+	var files []fileArg
+	var fromStdin bool
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "@@"):
+			expanded = append(expanded, arg[1:])
+			continue
+		case arg == "@-":
+			if fromStdin || r.scriptFromStdin {
+				return nil, nil, false, errors.New("stdin can only be used once, by --script or a single @- argument")
+			}
+			data, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return nil, nil, false, errors.Wrap(err, "cannot read @- from stdin")
+			}
+			fromStdin = true
+			files = append(files, fileArg{name: fmt.Sprintf("%d-stdin", len(files)+1), data: data, mode: 0644})
+		case strings.HasPrefix(arg, "@") && len(arg) > 1:
+			info, err := os.Stat(arg[1:])
+			if err != nil || !info.Mode().IsRegular() {
+				expanded = append(expanded, arg)
+				continue
+			}
+			data, err := ioutil.ReadFile(arg[1:])
+			if err != nil {
+				return nil, nil, false, errors.Wrapf(err, "cannot read %s", arg)
+			}
+			name := fmt.Sprintf("%d-%s", len(files)+1, filepath.Base(arg[1:]))
+			files = append(files, fileArg{name: name, data: data, mode: info.Mode().Perm()})
+		default:
+			expanded = append(expanded, arg)
+			continue
+		}
+		expanded = append(expanded, path.Join(fileArgsDir, files[len(files)-1].name))
+	}
+	return expanded, files, fromStdin, nil
+}
+
+// copyFileArgs uploads the files of @path arguments into the created container
+func copyFileArgs(ctx context.Context, docker *docker_cli.Client, containerId string, files []fileArg) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	dir := strings.TrimPrefix(fileArgsDir, "/")
+	if err := tw.WriteHeader(&tar.Header{Name: dir + "/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: time.Now()}); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    dir + "/" + f.name,
+			Mode:    int64(f.mode),
+			Size:    int64(len(f.data)),
+			ModTime: time.Now(),
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	err := docker.CopyToContainer(ctx, containerId, "/", &buf, docker_t.CopyToContainerOptions{})
+	return errors.Wrap(err, "cannot copy argument files into container")
+}
+
+func init() {
+	rootCmd.Flags().BoolVar(&cliOptions.fileArgs, "file-args", false, "upload host files of @path arguments, and stdin for @-, and pass their path in the container (@@ escapes @)")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandFileArgs(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.csv")
+	if err := ioutil.WriteFile(input, []byte("a,b\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		fileArgs  bool
+		args      []string
+		want      []string
+		wantFiles []string
+		wantErr   bool
+	}{
+		{
+			name: "disabled",
+			args: []string{"@" + input, "@@x"},
+			want: []string{"@" + input, "@@x"},
+		},
+		{
+			name:      "file",
+			fileArgs:  true,
+			args:      []string{"--in", "@" + input, "plain"},
+			want:      []string{"--in", "/.runonce-files/1-input.csv", "plain"},
+			wantFiles: []string{"1-input.csv"},
+		},
+		{
+			name:     "escaped and missing",
+			fileArgs: true,
+			args:     []string{"@@" + input, "@" + filepath.Join(dir, "missing"), "@", "@" + dir},
+			want:     []string{"@" + input, "@" + filepath.Join(dir, "missing"), "@", "@" + dir},
+		},
+		{
+			name:      "numbered",
+			fileArgs:  true,
+			args:      []string{"@" + input, "@" + input},
+			want:      []string{"/.runonce-files/1-input.csv", "/.runonce-files/2-input.csv"},
+			wantFiles: []string{"1-input.csv", "2-input.csv"},
+		},
+	}
+	for _, tt := range tests {
+		r := newRunner(options{fileArgs: tt.fileArgs})
+		got, files, fromStdin, err := r.expandFileArgs(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: args = %q, want %q", tt.name, got, tt.want)
+		}
+		var names []string
+		for _, f := range files {
+			names = append(names, f.name)
+			if string(f.data) != "a,b\n" {
+				t.Errorf("%s: file %s = %q", tt.name, f.name, f.data)
+			}
+		}
+		if !reflect.DeepEqual(names, tt.wantFiles) {
+			t.Errorf("%s: files = %q, want %q", tt.name, names, tt.wantFiles)
+		}
+		if fromStdin {
+			t.Errorf("%s: read stdin", tt.name)
+		}
+	}
+}
+
+func TestExpandFileArgsStdinOnce(t *testing.T) {
+	r := newRunner(options{fileArgs: true, scriptFromStdin: true})
+	if _, _, _, err := r.expandFileArgs([]string{"@-"}); err == nil {
+		t.Error("@- with --script from stdin was accepted")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ghaEscaper escapes workflow command data as required by the Actions runner
+var ghaEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+// ghaCommand writes a GitHub Actions workflow command; they must go to stdout
+func (r *Runner) ghaCommand(command, message string) {
+	if !r.githubActions {
+		return
+	}
+	fmt.Fprintf(os.Stdout, "::%s::%s\n", command, ghaEscaper.Replace(message))
+}
+
+// ghaReport annotates the workflow run with the outcome of the run
+func (r *Runner) ghaReport(result *runResult) {
+	switch {
+	case result.OOMKilled:
+		r.ghaCommand("error", fmt.Sprintf("%s was killed for running out of memory", result.Image))
+	case result.TimedOut:
+		r.ghaCommand("error", fmt.Sprintf("%s timed out after %s", result.Image, r.formatDuration(result.Duration)))
+	case result.ExitCode != 0:
+		r.ghaCommand("error", fmt.Sprintf("%s failed: %s", result.Image, result.Error))
+	}
+}
+
+func init() {
+	rootCmd.Flags().BoolVar(&cliOptions.githubActions, "gha", false, "emit GitHub Actions annotations and group the container output")
+}
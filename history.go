@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	mrand "math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "show previous runs recorded with --history",
+	Args:  cobra.NoArgs,
+	RunE:  runnerCommand((*Runner).showHistory),
+}
+
+// historyEntry is one recorded run
+type historyEntry struct {
+	RunID    string        `json:"runId"`
+	Image    string        `json:"image"`
+	Digest   string        `json:"digest,omitempty"`
+	ArgsHash string        `json:"argsHash"`
+	Key      string        `json:"key,omitempty"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	ExitCode int           `json:"exitCode"`
+	Duration time.Duration `json:"duration"`
+	Host     string        `json:"host"`
+	Error    string        `json:"error,omitempty"`
+
+	CPUSeconds  float64 `json:"cpuSeconds,omitempty"`
+	MemoryHours float64 `json:"memoryGibHours,omitempty"`
+}
+
+// newRunID returns a random (version 4) UUID identifying a run
+func newRunID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// argsHash identifies an argument list without storing the (possibly sensitive) arguments
+func argsHash(args []string) string {
+	data, _ := json.Marshal(args)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+func historyPath() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "docker-runonce", "history.jsonl"), nil
+}
+
+func readHistory(path string) ([]historyEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// skip lines torn by a crash rather than losing the whole history
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// historyCompactOneIn is how rarely recording a run compacts the history, which rewrites it
+const historyCompactOneIn = 64
+
+// recordHistory appends the entry; now and then the retention settings are applied
+func (r *Runner) recordHistory(entry historyEntry) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	lock := flock.New(path + ".lock")
+	if err := lock.Lock(); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	rnd := mrand.New(mrand.NewSource(time.Now().UnixNano()))
+	if rnd.Intn(historyCompactOneIn) != 0 {
+		return nil
+	}
+	return r.compactHistory(path)
+}
+
+// compactHistory drops the entries beyond the retention settings; the caller holds the lock
+func (r *Runner) compactHistory(path string) error {
+	entries, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+
+	var kept []historyEntry
+	for _, e := range entries {
+		if r.historyRetention <= 0 || time.Since(e.Start) <= r.historyRetention {
+			kept = append(kept, e)
+		}
+	}
+	if r.historyMaxEntries > 0 && len(kept) > r.historyMaxEntries {
+		kept = kept[len(kept)-r.historyMaxEntries:]
+	}
+	if len(kept) == len(entries) {
+		return nil
+	}
+
+	var sb strings.Builder
+	for _, e := range kept {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		sb.Write(data)
+		sb.WriteByte('\n')
+	}
+
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, []byte(sb.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// findRecentSuccess returns the latest successful run within window that matches
+// the custom dedupe key, or image and arguments if no key is given
+func findRecentSuccess(image, argsHash, key string, window time.Duration) (*historyEntry, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readHistory(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.ExitCode != 0 || time.Since(e.End) > window {
+			continue
+		}
+		if (key != "" && e.Key == key) || (key == "" && e.Image == image && e.ArgsHash == argsHash) {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *Runner) showHistory(cmd *cobra.Command, args []string) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	entries, err := readHistory(path)
+	if err != nil {
+		return errors.Wrap(err, "cannot read run history")
+	}
+
+	var matching []historyEntry
+	for _, e := range entries {
+		if r.historyImage != "" && e.Image != r.historyImage && !strings.HasPrefix(e.Image, r.historyImage+":") {
+			continue
+		}
+		if r.historyFailed && e.ExitCode == 0 {
+			continue
+		}
+		matching = append(matching, e)
+	}
+	if r.historyLimit > 0 && len(matching) > r.historyLimit {
+		matching = matching[len(matching)-r.historyLimit:]
+	}
+
+	if r.historyJSON {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		for _, e := range matching {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN ID\tIMAGE\tSTARTED\tDURATION\tEXIT\tHOST")
+	for _, e := range matching {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", e.RunID, e.Image, e.Start.Local().Format("2006-01-02 15:04:05"),
+			r.formatDuration(e.Duration), e.ExitCode, e.Host)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	rootCmd.Flags().BoolVar(&cliOptions.historyEnabled, "history", false, "record the run in the local run history ($XDG_DATA_HOME/docker-runonce/history.jsonl)")
+	rootCmd.Flags().DurationVar(&cliOptions.historyRetention, "history-retention", 90*24*time.Hour, "drop history entries older than this when compacting the history (0 keeps all)")
+	rootCmd.Flags().IntVar(&cliOptions.historyMaxEntries, "history-max-entries", 10000, "keep at most this many history entries when compacting the history (0 keeps all)")
+
+	rootCmd.Flags().DurationVar(&cliOptions.dedupeWindow, "dedupe-window", 0, "skip the run if an identical run succeeded within this window")
+	rootCmd.Flags().StringVar(&cliOptions.dedupeKey, "dedupe-key", "", "identify identical runs by this key instead of image and arguments")
+	rootCmd.Flags().IntVar(&cliOptions.dedupeExitCode, "dedupe-exit-code", 0, "exit code when a run is skipped as duplicate")
+
+	historyCmd.Flags().StringVar(&cliOptions.historyImage, "image", "", "only show runs of this image")
+	historyCmd.Flags().BoolVar(&cliOptions.historyFailed, "failed", false, "only show failed runs")
+	historyCmd.Flags().IntVar(&cliOptions.historyLimit, "limit", 20, "show at most this many runs (0 shows all)")
+	historyCmd.Flags().BoolVar(&cliOptions.historyJSON, "json", false, "print runs as NDJSON")
+	rootCmd.AddCommand(historyCmd)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordHistory(t *testing.T) {
+	defer os.Setenv("XDG_DATA_HOME", os.Getenv("XDG_DATA_HOME"))
+	os.Setenv("XDG_DATA_HOME", t.TempDir())
+	path, err := historyPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newRunner(options{historyMaxEntries: 3})
+	for i := 0; i < 5; i++ {
+		if err := r.recordHistory(historyEntry{RunID: string(rune('a' + i)), Start: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := readHistory(path)
+	if err != nil || len(entries) < 3 {
+		t.Fatalf("readHistory() = %d entries, %v", len(entries), err)
+	}
+	if entries[len(entries)-1].RunID != "e" {
+		t.Errorf("last entry %q, want the last recorded", entries[len(entries)-1].RunID)
+	}
+
+	old := historyEntry{RunID: "old", Start: time.Now().Add(-48 * time.Hour)}
+	if err := r.recordHistory(old); err != nil {
+		t.Fatal(err)
+	}
+	r.historyRetention = 24 * time.Hour
+	if err := r.compactHistory(path); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = readHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids string
+	for _, e := range entries {
+		ids += e.RunID
+	}
+	if ids != "cde" {
+		t.Errorf("compacted history %q, want %q", ids, "cde")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "history.jsonl.tmp")); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
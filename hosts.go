@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+// dockerConfigDir is where the docker CLI keeps its configuration and contexts
+func dockerConfigDir() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".docker"), nil
+}
+
+// daemonEnv returns the environment selecting the daemon of a DOCKER_HOST URL or a docker CLI context
+func daemonEnv(host string) ([]string, error) {
+	if strings.Contains(host, "://") {
+		return []string{"DOCKER_HOST=" + host}, nil
+	}
+
+	dir, err := dockerConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(host))
+	id := hex.EncodeToString(sum[:])
+	data, err := ioutil.ReadFile(filepath.Join(dir, "contexts", "meta", id, "meta.json"))
+	if err != nil {
+		return nil, errors.Errorf("unknown docker context '%s'", host)
+	}
+	var meta struct {
+		Endpoints struct {
+			Docker struct {
+				Host          string `json:"Host"`
+				SkipTLSVerify bool   `json:"SkipTLSVerify"`
+			} `json:"docker"`
+		} `json:"Endpoints"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil || meta.Endpoints.Docker.Host == "" {
+		return nil, errors.Errorf("docker context '%s' has no docker endpoint", host)
+	}
+
+	// the TLS settings of the context replace those of the environment, empty ones count as unset
+	certPath, tlsVerify := "", ""
+	tlsDir := filepath.Join(dir, "contexts", "tls", id, "docker")
+	if _, err := os.Stat(tlsDir); err == nil {
+		certPath = tlsDir
+		if !meta.Endpoints.Docker.SkipTLSVerify {
+			tlsVerify = "1"
+		}
+	}
+	return []string{"DOCKER_HOST=" + meta.Endpoints.Docker.Host, "DOCKER_CERT_PATH=" + certPath, "DOCKER_TLS_VERIFY=" + tlsVerify}, nil
+}
+
+// childArgs is the command line for running the same job again without the given flags: the flags
+// given on the command line or in the environment with their values, the image of an executable name
+// and the container args
+func (r *Runner) childArgs(without []string, args []string) []string {
+	var childArgs []string
+	if !r.changed("image") && r.imageName != "" {
+		childArgs = append(childArgs, "--image", r.imageName)
+	}
+	if r.flags != nil {
+		r.flags.Visit(func(f *pflag.Flag) {
+			for _, name := range without {
+				if f.Name == name {
+					return
+				}
+			}
+			values := []string{f.Value.String()}
+			if slice, ok := f.Value.(pflag.SliceValue); ok {
+				values = slice.GetSlice()
+			}
+			for _, v := range values {
+				childArgs = append(childArgs, "--"+f.Name+"="+v)
+			}
+		})
+	}
+	return append(append(childArgs, "--"), args...)
+}
+
+// environWithout is the environment without the variable, so children do not act on it again
+func environWithout(name string) []string {
+	var env []string
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, name+"=") {
+			env = append(env, e)
+		}
+	}
+	return env
+}
+
+// runOnHosts runs the job on every --hosts daemon at once, each as a child process of its own
+// with its output prefixed by the host; stdin is not forwarded, there is no single consumer for it
+func (r *Runner) runOnHosts(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	envs := make([][]string, len(r.daemonHosts))
+	for i, host := range r.daemonHosts {
+		if envs[i], err = daemonEnv(host); err != nil {
+			return err
+		}
+	}
+	childArgs := r.childArgs([]string{"hosts"}, args)
+
+	// the children get the signal of the process group too; this just waits for them
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	codes := make([]int, len(r.daemonHosts))
+	var wg sync.WaitGroup
+	for i, host := range r.daemonHosts {
+		c := exec.Command(exe, childArgs...)
+		c.Env = append(environWithout("RUNONCE_HOSTS"), envs[i]...)
+		prefix := outputPrefix("["+host+"] ", host, r.colorOutput)
+		c.Stdout = newLineWriter(os.Stdout, func() string { return prefix })
+		c.Stderr = newLineWriter(os.Stderr, func() string { return prefix })
+		if err := c.Start(); err != nil {
+			return errors.Wrapf(err, "cannot start run on %s", host)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = c.Wait()
+			codes[i] = c.ProcessState.ExitCode()
+		}(i)
+	}
+	wg.Wait()
+
+	tw := tabwriter.NewWriter(os.Stderr, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tEXIT")
+	exitCode := 0
+	for i, host := range r.daemonHosts {
+		fmt.Fprintf(tw, "%s\t%d\n", host, codes[i])
+		if codes[i] != 0 && exitCode == 0 {
+			exitCode = codes[i]
+		}
+	}
+	_ = tw.Flush()
+	if exitCode != 0 {
+		return &exitCodeError{code: exitCode}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.Flags().StringSliceVar(&cliOptions.daemonHosts, "hosts", nil, "run the job on each of these daemons at once, given as docker contexts or DOCKER_HOST URLs")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChildArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		image   string
+		cmdline []string
+		args    []string
+		want    []string
+	}{
+		{
+			name:    "flags",
+			cmdline: []string{"--image", "alpine", "--hosts", "a,b", "--hosts", "c"},
+			args:    []string{"echo"},
+			want:    []string{"--image=alpine", "--", "echo"},
+		},
+		{
+			name:    "other flags kept",
+			cmdline: []string{"--image=alpine", "--hosts=a", "--remote", "broker:7000"},
+			want:    []string{"--image=alpine", "--remote=broker:7000", "--"},
+		},
+		{
+			name:    "executable name",
+			image:   "tool",
+			cmdline: []string{"--hosts", "a,b"},
+			args:    []string{"--hosts", "a,b"},
+			want:    []string{"--image", "tool", "--", "--hosts", "a,b"},
+		},
+	}
+	for _, tt := range tests {
+		opts := options{imageName: tt.image}
+		cmd := testCommand(t, &opts, tt.cmdline)
+		r := newRunner(opts)
+		r.flags = cmd.Flags()
+		if got := r.childArgs([]string{"hosts"}, tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: childArgs = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/filters"
+	"github.com/pkg/errors"
+)
+
+// maxSuggestions limits the local tags listed when an image cannot be found
+const maxSuggestions = 5
+
+// locateImage finds the single local image matching the reference filter; with --disambiguate latest
+// the most recently created of several matches is taken. Failures suggest references to use instead.
+func (r *Runner) locateImage(ctx context.Context, docker *docker_cli.Client, ref string) (docker_t.ImageSummary, string, error) {
+	refFilter := filters.NewArgs()
+	refFilter.Add("reference", ref)
+	summaries, err := docker.ImageList(ctx, docker_t.ImageListOptions{Filters: refFilter})
+	if err != nil {
+		return docker_t.ImageSummary{}, "", err
+	}
+
+	switch {
+	case len(summaries) == 1:
+		return summaries[0], ref, nil
+	case len(summaries) == 0:
+		if similar := similarTags(ctx, docker, ref); len(similar) > 0 {
+			return docker_t.ImageSummary{}, "", errors.Wrapf(ErrImageNotFound,
+				"could not locate image '%s', did you mean %s?", ref, quoteList(similar))
+		}
+		return docker_t.ImageSummary{}, "", errors.Wrapf(ErrImageNotFound, "could not locate image '%s'", ref)
+	case r.disambiguate == "latest":
+		sort.Slice(summaries, func(i, j int) bool { return summaries[i].Created > summaries[j].Created })
+		chosen := summaries[0]
+		exact := chosen.ID
+		if len(chosen.RepoTags) > 0 {
+			exact = chosen.RepoTags[0]
+		}
+		r.log.Printf("image '%s' matches %d images, using the most recent one %s\n", ref, len(summaries), exact)
+		return chosen, exact, nil
+	}
+
+	var candidates []string
+	for _, s := range summaries {
+		if len(s.RepoTags) == 0 {
+			candidates = append(candidates, s.ID)
+		}
+		candidates = append(candidates, s.RepoTags...)
+	}
+	sort.Strings(candidates)
+	return docker_t.ImageSummary{}, "", errors.Wrapf(ErrImageNotFound,
+		"image '%s' is ambiguous, use one of %s or --disambiguate latest", ref, quoteList(candidates))
+}
+
+// similarTags returns the local tags closest to ref, best first
+func similarTags(ctx context.Context, docker *docker_cli.Client, ref string) []string {
+	summaries, err := docker.ImageList(ctx, docker_t.ImageListOptions{})
+	if err != nil {
+		return nil
+	}
+
+	type match struct {
+		tag      string
+		distance int
+	}
+	var matches []match
+	for _, s := range summaries {
+		for _, tag := range s.RepoTags {
+			if tag == "<none>:<none>" {
+				continue
+			}
+			d := editDistance(ref, tag)
+			if repo := tag[:strings.LastIndex(tag, ":")]; strings.Contains(repo, ref) || strings.Contains(ref, repo) {
+				d = 0
+			}
+			if d <= len(ref)/3+1 {
+				matches = append(matches, match{tag, d})
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].tag < matches[j].tag
+	})
+
+	var tags []string
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		tags = append(tags, matches[i].tag)
+	}
+	return tags
+}
+
+// editDistance is the Levenshtein distance of a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+func quoteList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = "'" + item + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.disambiguate, "disambiguate", "", "if several local images match: latest uses the most recently created one")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// jobSpec is a declarative invocation, see 'docker-runonce run --help'
+type jobSpec struct {
+	Image   string   `yaml:"image"`
+	Command []string `yaml:"command"`
+	Env     []string `yaml:"env"`
+	Mounts  []string `yaml:"mounts"`
+	Timeout string   `yaml:"timeout"`
+	Limits  struct {
+		Memory string `yaml:"memory"`
+		CPUs   string `yaml:"cpus"`
+	} `yaml:"limits"`
+	Hooks map[string]string `yaml:"hooks"`
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run [flags] [-f runonce.yaml] [args...]",
+	Short: "run docker image once, optionally as described by a job file",
+	Long: `run is the same as invoking docker-runonce without a command. A job file describes a run:
+
+  image: alpine:3.12
+  command: [sh, -c, "echo $GREETING"]
+  env: [GREETING=hello]
+  mounts: ["/srv/data:/data:ro"]
+  timeout: 30m
+  limits:
+    memory: 512Mi
+    cpus: "2"
+  hooks:                  # paths relative to the job file
+    pre-create: ./check.sh
+
+Flags given on the command line take precedence over the job file.`,
+	RunE: runCommandLine,
+}
+
+// shareRunFlags gives the run command the flags of the root command; it is called once all are registered
+func shareRunFlags() {
+	runCmd.Flags().AddFlagSet(rootCmd.Flags())
+}
+
+// applyJobFile fills in the options not given on the command line from the job file
+func (r *Runner) applyJobFile(args []string) ([]string, error) {
+	data, err := ioutil.ReadFile(r.jobFile)
+	if err != nil {
+		return nil, err
+	}
+	var job jobSpec
+	if err := yaml.Unmarshal(data, &job); err != nil {
+		return nil, errors.Wrapf(err, "invalid job file '%s'", r.jobFile)
+	}
+
+	setString := func(flag string, target *string, value string) {
+		if value != "" && !r.changed(flag) {
+			*target = value
+		}
+	}
+	setString("image", &r.imageName, job.Image)
+	setString("memory-limit", &r.memoryLimit, job.Limits.Memory)
+	setString("cpus", &r.cpus, job.Limits.CPUs)
+	setString("timeout", &r.timeout, job.Timeout)
+
+	r.envVars = append(job.Env, r.envVars...)
+	r.volumeBinds = append(job.Mounts, r.volumeBinds...)
+
+	r.jobHooks = map[string]string{}
+	for hook, path := range job.Hooks {
+		switch hook {
+		case "pre-create", "post-start", "pre-remove":
+		default:
+			return nil, errors.Errorf("unknown hook '%s' in job file", hook)
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(r.jobFile), path)
+		}
+		r.jobHooks[hook] = path
+	}
+
+	if len(args) == 0 {
+		args = job.Command
+	}
+	return args, nil
+}
+
+func init() {
+	rootCmd.Flags().StringVarP(&cliOptions.jobFile, "file", "f", "", "run as described by this job file")
+	rootCmd.AddCommand(runCmd)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApplyJobFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "job.yaml")
+	job := `image: alpine:3.12
+command: [echo, hi]
+env: [A=1]
+timeout: 30m
+limits:
+  memory: 512Mi
+hooks:
+  pre-create: ./check.sh
+`
+	if err := ioutil.WriteFile(path, []byte(job), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newRunner(options{jobFile: path, memoryLimit: "1Gi", timeout: "10s", envVars: []string{"B=2"}})
+	r.flags = testFlags(t, "memory-limit")
+	args, err := r.applyJobFile(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(args, []string{"echo", "hi"}) {
+		t.Errorf("args = %q", args)
+	}
+	if r.imageName != "alpine:3.12" || r.timeout != "30m" || r.memoryLimit != "1Gi" {
+		t.Errorf("image %q, timeout %q, memory limit %q", r.imageName, r.timeout, r.memoryLimit)
+	}
+	if !reflect.DeepEqual(r.envVars, []string{"A=1", "B=2"}) {
+		t.Errorf("env = %q", r.envVars)
+	}
+	if want := filepath.Join(dir, "check.sh"); r.jobHooks["pre-create"] != want {
+		t.Errorf("pre-create hook %q, want %q", r.jobHooks["pre-create"], want)
+	}
+}
+
+func TestRunCommandFlags(t *testing.T) {
+	shareRunFlags()
+	for _, name := range []string{"file", "image", "memory-limit"} {
+		if runCmd.Flags().Lookup(name) == nil {
+			t.Errorf("run command has no --%s", name)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Hostname  string      `xml:"hostname,attr,omitempty"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Output  string `xml:",chardata"`
+}
+
+// writeJUnit writes the run as a single-testcase JUnit report
+func writeJUnit(path string, result *runResult, stderrTail string) error {
+	seconds := fmt.Sprintf("%.3f", result.Duration.Seconds())
+	testCase := junitCase{
+		Name:      strings.TrimSpace(result.Image + " " + strings.Join(result.Args, " ")),
+		ClassName: "docker-runonce",
+		Time:      seconds,
+	}
+	if result.ExitCode != 0 {
+		message := result.Error
+		if result.TimedOut {
+			message = "run timed out"
+		}
+		testCase.Failure = &junitFailure{Message: message, Type: "ExitCode", Output: stderrTail}
+	}
+
+	suite := junitSuite{
+		Name:      "docker-runonce",
+		Tests:     1,
+		Time:      seconds,
+		Timestamp: result.Start.Format("2006-01-02T15:04:05"),
+		Hostname:  result.Host,
+		Cases:     []junitCase{testCase},
+	}
+	if testCase.Failure != nil {
+		suite.Failures = 1
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.junitPath, "junit", "", "write a JUnit XML report of the run to this file")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"regexp"
+	"strconv"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/filters"
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+// labels put on every container created by docker-runonce, so later invocations can find them
+const (
+	labelManaged  = "docker-runonce.managed"
+	labelRunID    = "docker-runonce.run-id"
+	labelImage    = "docker-runonce.image"
+	labelArgsHash = "docker-runonce.args-hash"
+	labelName     = "docker-runonce.name"
+	labelRole     = "docker-runonce.role"
+	labelTimeout  = "docker-runonce.timeout"
+)
+
+// labelOptionFlags maps image label options to the flags that take precedence over them;
+// TIMEOUT_MAX has none, it caps explicit timeouts too
+var labelOptionFlags = map[string]string{
+	"MEMORY_LIMIT":       "memory-limit",
+	"BIND_CWD":           "bind-cwd",
+	"TIMEOUT":            "timeout",
+	"CONCURRENT":         "concurrent",
+	"RUNTIME":            "runtime",
+	"CPUS":               "cpus",
+	"MEMORY_SWAP":        "memory-swap",
+	"MEMORY_RESERVATION": "memory-reservation",
+	"MEMORY_SWAPPINESS":  "memory-swappiness",
+	"STOP_SIGNAL":        "stop-signal",
+	"MAP_EXIT_CODE":      "map-exit-code",
+	"WINDOW":             "window",
+}
+
+var signalRegexp = regexp.MustCompile(`^(SIG[A-Z0-9+-]+|[A-Z][A-Z0-9+-]*|[0-9]+)$`)
+
+// parseLabelList parses a JSON array of strings like ["--verbose", "run"]
+func parseLabelList(value string) ([]string, error) {
+	var list []string
+	if err := json.Unmarshal([]byte(value), &list); err != nil {
+		return nil, errors.New("expected a JSON array of strings")
+	}
+	return list, nil
+}
+
+// validateLabelOption checks an option label for --strict-labels
+func (r *Runner) validateLabelOption(name, value string) error {
+	// relative values only need to be well-formed here
+	probe := &docker_t.Info{MemTotal: 1 << 30, NCPU: 1}
+	var err error
+	switch name {
+	case "MEMORY_LIMIT":
+		_, err = parseMemorySize(value, probe)
+	case "MEMORY_RESERVATION":
+		_, err = humanize.ParseBytes(value)
+	case "MEMORY_SWAP":
+		if value != "-1" {
+			_, err = humanize.ParseBytes(value)
+		}
+	case "MEMORY_SWAPPINESS":
+		var n int
+		if n, err = strconv.Atoi(value); err == nil && (n < 0 || n > 100) {
+			err = errors.New("expected 0-100")
+		}
+	case "TIMEOUT", "TIMEOUT_MAX":
+		_, err = parseTimeout(value)
+	case "CONCURRENT":
+		_, err = strconv.ParseBool(value)
+	case "CPUS":
+		_, err = parseCPUs(value, probe)
+	case "BIND_CWD":
+		if value != "" && !path.IsAbs(value) {
+			err = errors.New("expected an absolute path")
+		}
+	case "STOP_SIGNAL":
+		if !signalRegexp.MatchString(value) {
+			err = errors.New("expected a signal name like SIGINT or a number")
+		}
+	case "MAP_EXIT_CODE":
+		_, err = parseExitCodeMap([]string{value})
+	case "WINDOW":
+		_, err = parseWindow(value)
+	case "ARGS", "ENTRYPOINT":
+		_, err = parseLabelList(value)
+	case "RUNTIME":
+	default:
+		return errors.Errorf("unknown option label %s%s", r.optionLabelPrefix, name)
+	}
+	return errors.Wrapf(err, "invalid value %q of option label %s%s", value, r.optionLabelPrefix, name)
+}
+
+func (r *Runner) managedLabels(runID, image string, args []string) map[string]string {
+	labels := map[string]string{
+		labelManaged:  "true",
+		labelRunID:    runID,
+		labelImage:    image,
+		labelArgsHash: argsHash(args),
+	}
+	if r.runName != "" {
+		labels[labelName] = r.runName
+	}
+	return labels
+}
+
+// findManagedContainers lists managed containers whose labels match all of the given values
+func findManagedContainers(ctx context.Context, docker *docker_cli.Client, all bool, labels map[string]string) ([]docker_t.Container, error) {
+	labelFilters := filters.NewArgs()
+	labelFilters.Add("label", labelManaged+"=true")
+	for k, v := range labels {
+		labelFilters.Add("label", k+"="+v)
+	}
+	return docker.ContainerList(ctx, docker_t.ContainerListOptions{
+		All:     all,
+		Filters: labelFilters,
+	})
+}
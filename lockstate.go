@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	"docker.io/go-docker/api/types/container"
+)
+
+// labelLockKey marks containers of non-concurrent runs, so they are found even after
+// a killed instance released its lock
+const labelLockKey = "docker-runonce.lock-key"
+
+// lockState records the run holding the lock; unlike the lock it survives a crash of the instance
+type lockState struct {
+	RunID       string    `json:"runId"`
+	PID         int       `json:"pid"`
+	ContainerID string    `json:"containerId,omitempty"`
+	Start       time.Time `json:"start"`
+}
+
+func lockKeyHash(lockKey string) string {
+	sum := sha256.Sum256([]byte(lockKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+func lockStatePath(lockKey string) (string, error) {
+	path, err := historyPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "locks", lockKeyHash(lockKey)+".json"), nil
+}
+
+func writeLockState(lockKey string, state lockState) error {
+	path, err := lockStatePath(lockKey)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func removeLockState(lockKey string) {
+	if path, err := lockStatePath(lockKey); err == nil {
+		_ = os.Remove(path)
+	}
+}
+
+// orphanedContainer returns the still running container of an earlier run of the lock key,
+// as recorded in the state file or found by its label
+func orphanedContainer(ctx context.Context, docker *docker_cli.Client, lockKey string) (string, error) {
+	if path, err := lockStatePath(lockKey); err == nil {
+		var state lockState
+		if data, err := ioutil.ReadFile(path); err == nil && json.Unmarshal(data, &state) == nil &&
+			state.ContainerID != "" && containerRunning(ctx, docker, state.ContainerID) {
+			return state.ContainerID, nil
+		}
+	}
+
+	containers, err := findManagedContainers(ctx, docker, false, map[string]string{labelLockKey: lockKeyHash(lockKey)})
+	if err != nil || len(containers) == 0 {
+		return "", err
+	}
+	return containers[0].ID, nil
+}
+
+// waitForContainer blocks until the container is no longer running
+func waitForContainer(ctx context.Context, docker *docker_cli.Client, containerId string) error {
+	waitCh, waitErrCh := docker.ContainerWait(ctx, containerId, container.WaitConditionNotRunning)
+	select {
+	case <-waitCh:
+		return nil
+	case err := <-waitErrCh:
+		return err
+	}
+}
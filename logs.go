@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	docker_t "docker.io/go-docker/api/types"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs <name|run-id>",
+	Short: "fetch the output of a managed run",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runnerCommand((*Runner).showLogs),
+}
+
+func (r *Runner) showLogs(cmd *cobra.Command, args []string) error {
+	docker, err := r.newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer docker.Close()
+
+	ctx := context.Background()
+	ref := args[0]
+	containers, err := findManagedContainers(ctx, docker, true, map[string]string{labelRunID: ref})
+	if err == nil && len(containers) == 0 {
+		containers, err = findManagedContainers(ctx, docker, true, map[string]string{labelName: ref})
+	}
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return errors.Errorf("no container found for run '%s'", ref)
+	}
+
+	// ContainerList returns the newest container first
+	rc, err := docker.ContainerLogs(ctx, containers[0].ID, docker_t.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     r.logsFollow,
+		Tail:       r.logsTail,
+		Timestamps: r.logsTimestamps,
+	})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return demuxStream(rc, os.Stdout, os.Stderr)
+}
+
+func init() {
+	logsCmd.Flags().BoolVarP(&cliOptions.logsFollow, "follow", "f", false, "follow the output while the run continues")
+	logsCmd.Flags().StringVar(&cliOptions.logsTail, "tail", "all", "number of lines to show from the end")
+	logsCmd.Flags().BoolVarP(&cliOptions.logsTimestamps, "timestamps", "t", false, "show timestamps")
+	rootCmd.AddCommand(logsCmd)
+}
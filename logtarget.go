@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// syslog-style priorities and facilities, shared by the syslog and journald sinks
+const (
+	priorityErr  = 3
+	priorityInfo = 6
+)
+
+var logFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// closers closes all of its closers, returning the first error
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var err error
+	for _, closer := range c {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// openLogTarget returns writers for informational and error messages of docker-runonce itself,
+// and the closer of both
+func openLogTarget(target, facilityName string) (info io.Writer, errs io.Writer, closer io.Closer, err error) {
+	facility, ok := logFacilities[facilityName]
+	if !ok {
+		return nil, nil, nil, errors.Errorf("unknown log facility '%s'", facilityName)
+	}
+
+	switch {
+	case target == "" || target == "stderr":
+		return os.Stderr, os.Stderr, closers(nil), nil
+	case strings.HasPrefix(target, "file:"):
+		f, err := os.OpenFile(strings.TrimPrefix(target, "file:"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return f, f, f, nil
+	case target == "syslog":
+		return openSyslog(facility)
+	case target == "journald":
+		return openJournald(facility)
+	default:
+		return nil, nil, nil, errors.Errorf("unknown log target '%s'", target)
+	}
+}
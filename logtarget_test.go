@@ -0,0 +1,29 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenLogTargetClose(t *testing.T) {
+	info, _, closer, err := openLogTarget("file:"+filepath.Join(t.TempDir(), "run.log"), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := info.Write([]byte("line\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := info.Write([]byte("line\n")); err == nil {
+		t.Error("the log file is still open after closing the target")
+	}
+
+	if _, _, closer, err = openLogTarget("stderr", "user"); err != nil {
+		t.Fatal(err)
+	}
+	if err := closer.Close(); err != nil {
+		t.Errorf("closing stderr target: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const journaldSocket = "/run/systemd/journal/socket"
+
+func openSyslog(facility int) (io.Writer, io.Writer, io.Closer, error) {
+	tag := filepath.Base(os.Args[0])
+	info, err := syslog.New(syslog.Priority(facility<<3|priorityInfo), tag)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	errs, err := syslog.New(syslog.Priority(facility<<3|priorityErr), tag)
+	if err != nil {
+		info.Close()
+		return nil, nil, nil, err
+	}
+	return info, errs, closers{info, errs}, nil
+}
+
+func openJournald(facility int) (io.Writer, io.Writer, io.Closer, error) {
+	conn, err := net.Dial("unixgram", journaldSocket)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tag := filepath.Base(os.Args[0])
+	return &journaldWriter{conn: conn, tag: tag, facility: facility, priority: priorityInfo},
+		&journaldWriter{conn: conn, tag: tag, facility: facility, priority: priorityErr}, conn, nil
+}
+
+// journaldWriter sends each write as one entry using the journal native protocol
+type journaldWriter struct {
+	conn     net.Conn
+	tag      string
+	facility int
+	priority int
+}
+
+func (w *journaldWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+	entry := fmt.Sprintf("PRIORITY=%d\nSYSLOG_FACILITY=%d\nSYSLOG_IDENTIFIER=%s\n",
+		w.priority, w.facility, w.tag)
+	if strings.Contains(msg, "\n") {
+		// multi-line values use the binary length-prefixed form
+		var size [8]byte
+		for i, n := 0, uint64(len(msg)); i < 8; i++ {
+			size[i] = byte(n >> (8 * i))
+		}
+		entry += "MESSAGE\n" + string(size[:]) + msg + "\n"
+	} else {
+		entry += "MESSAGE=" + msg + "\n"
+	}
+	if _, err := w.conn.Write([]byte(entry)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+func openSyslog(facility int) (io.Writer, io.Writer, io.Closer, error) {
+	return nil, nil, nil, errors.New("syslog is not supported on windows")
+}
+
+func openJournald(facility int) (io.Writer, io.Writer, io.Closer, error) {
+	return nil, nil, nil, errors.New("journald is not supported on windows")
+}
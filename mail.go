@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+// smtpConfig is the smtp section of the config file; port 465 uses implicit TLS, others STARTTLS if offered
+type smtpConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// checkMailOptions validates the mail flags and the smtp settings before the run, and returns
+// the size of the output tail to include
+func (r *Runner) checkMailOptions() (int, error) {
+	if len(r.mailTo) == 0 {
+		return 0, nil
+	}
+	if r.mailOn != "failure" && r.mailOn != "always" {
+		return 0, errors.Errorf("invalid --mail-on value '%s', expected failure or always", r.mailOn)
+	}
+	size, err := humanize.ParseBytes(r.mailTail)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid --mail-tail '%s'", r.mailTail)
+	}
+	cfg, err := r.loadConfig()
+	if err != nil {
+		return 0, err
+	}
+	if cfg.SMTP.Host == "" || cfg.SMTP.From == "" {
+		return 0, errors.Errorf("--mail-to needs smtp host and from in %s", r.configPath)
+	}
+	return int(size), nil
+}
+
+// mailMessage renders the run summary and the tail of its output as a plain text mail
+func (r *Runner) mailMessage(from string, result *runResult) []byte {
+	outcome := "succeeded"
+	if result.ExitCode != 0 {
+		outcome = fmt.Sprintf("failed with exit code %d", result.ExitCode)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(r.mailTo, ", "))
+	fmt.Fprintf(&b, "Subject: [docker-runonce] %s %s\r\n", result.Image, outcome)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+
+	fmt.Fprintf(&b, "Run:       %s\r\n", result.RunID)
+	fmt.Fprintf(&b, "Image:     %s\r\n", result.Image)
+	fmt.Fprintf(&b, "Host:      %s\r\n", result.Host)
+	fmt.Fprintf(&b, "Started:   %s\r\n", result.Start.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Duration:  %s\r\n", r.formatDuration(result.Duration))
+	fmt.Fprintf(&b, "Exit code: %d\r\n", result.ExitCode)
+	if result.TimedOut {
+		b.WriteString("Timed out\r\n")
+	}
+	if result.OOMKilled {
+		b.WriteString("Killed for running out of memory\r\n")
+	}
+	if result.Error != "" {
+		fmt.Fprintf(&b, "Error:     %s\r\n", result.Error)
+	}
+	if tail := result.outputTail.String(); tail != "" {
+		fmt.Fprintf(&b, "\r\nLast %s of output:\r\n\r\n", r.formatBytes(uint64(len(tail))))
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(tail, "\r\n", "\n"), "\n", "\r\n"))
+	}
+	return b.Bytes()
+}
+
+// sendRunMail mails the result to --mail-to through the configured SMTP server
+func (r *Runner) sendRunMail(result *runResult) error {
+	if r.mailOn == "failure" && result.ExitCode == 0 {
+		return nil
+	}
+	cfg, err := r.loadConfig()
+	if err != nil {
+		return err
+	}
+	s := cfg.SMTP
+	if s.Port == 0 {
+		s.Port = 25
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	msg := r.mailMessage(s.From, result)
+	if s.Port != 465 {
+		return smtp.SendMail(addr, auth, s.From, r.mailTo, msg)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: s.Host})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	for _, to := range r.mailTo {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func init() {
+	rootCmd.Flags().StringSliceVar(&cliOptions.mailTo, "mail-to", nil, "mail the run summary to these addresses, through the smtp server of the config file")
+	rootCmd.Flags().StringVar(&cliOptions.mailOn, "mail-on", "failure", "when to send mail: failure or always")
+	rootCmd.Flags().StringVar(&cliOptions.mailTail, "mail-tail", "16KiB", "how much of the end of the output to include in the mail")
+}
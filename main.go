@@ -3,23 +3,23 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	docker_cli "docker.io/go-docker"
 	docker_t "docker.io/go-docker/api/types"
 	"docker.io/go-docker/api/types/container"
-	"docker.io/go-docker/api/types/filters"
 	"docker.io/go-docker/api/types/mount"
-	"docker.io/go-docker/api/types/network"
 	"github.com/dustin/go-humanize"
 	"github.com/gofrs/flock"
-	"github.com/mkke/go-docker/attach"
-	"github.com/mkke/go-docker/responses"
 	"github.com/mkke/go-mlog"
 	"github.com/mkke/go-signalerror"
 	"github.com/pkg/errors"
@@ -31,38 +31,322 @@ var (
 	buildID   = "<wip>"
 )
 
-var (
-	timeout             string
-	bindCwd             string
-	memoryLimit         string
-	optionLabelPrefix   string
-	imageName           string
-	verbose             bool
-	stopTimeout         int
-	concurrentExecution bool
-	forwardImageArgs    bool
-)
-
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:           "docker-runonce",
-	Short:         "run docker image once",
-	RunE:          run,
+	Use:   "docker-runonce",
+	Short: "run docker image once",
+	Long: `run docker image once
+
+Every flag can also be set with a RUNONCE_ environment variable, e.g. RUNONCE_MEMORY_LIMIT=1Gi;
+repeatable flags take one value per line. Command line flags take precedence over the
+environment, the environment over --profile settings, and those over image label options.`,
+	Args:          cobra.ArbitraryArgs,
+	RunE:          runCommandLine,
 	SilenceErrors: true,
 	SilenceUsage:  true,
 }
 
 var log = mlog.NewWriterLogger(os.Stderr)
 
-func run(cmd *cobra.Command, args []string) error {
-	if imageName == "" {
+// errLog reports fatal errors; unlike log it is not silenced by --quiet
+var errLog = log
+
+// printfLogger is the part of the mlog interface needed by helpers that are handed a logger
+type printfLogger interface {
+	Printf(format string, v ...interface{})
+}
+
+// verbosity levels selected by repeating -v
+const (
+	verboseInfo  = 1
+	verboseDebug = 2
+	verboseTrace = 3
+)
+
+// stderrTailSize is how much of the container's stderr is kept for reports
+const stderrTailSize = 16 * 1024
+
+// drainTimeout bounds how long to wait for remaining output after the container is gone
+const drainTimeout = 5 * time.Second
+
+// exitCodeError carries a non-zero container exit status through to the process exit code
+type exitCodeError struct {
+	code   int
+	reason string
+}
+
+func (e *exitCodeError) Error() string {
+	if e.reason != "" {
+		return e.reason
+	}
+	return fmt.Sprintf("container exited with status %d", e.code)
+}
+
+// exitCode maps the result of a run to the process exit code
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	if code, ok := errorExitCode(err); ok {
+		return code
+	}
+	if code, ok := signalerror.ErrSignalExitCode(err); ok {
+		return code
+	}
+	return 1
+}
+
+// endReported is returned by a command whose run has reported the end of the process on its own
+// loggers; err is the result of the command
+type endReported struct {
+	err error
+}
+
+func (e *endReported) Error() string {
+	if e.err == nil {
+		return "process ends normally"
+	}
+	return e.err.Error()
+}
+
+// runCommandLine runs the job given on the command line; the run reports the end of the process
+// like everything else, e.g. to its --log-target
+func runCommandLine(cmd *cobra.Command, args []string) error {
+	return &endReported{err: cliRunner(cmd).runWithFallback(args)}
+}
+
+// reportEnd logs how the process ends, on failure unless the run's output already explains it
+func reportEnd(infoLog, errorLog mlog.Logger, verbosity int, err error) {
+	if err == nil {
+		if verbosity >= verboseInfo {
+			infoLog.Printf("Process ends normally.\n")
+		}
+		return
+	}
+	var exitErr *exitCodeError
+	switch {
+	case errors.As(err, &exitErr), errors.Is(err, ErrBrokenPipe), errors.Is(err, ErrCancelled):
+		// the container's own output or the logged signal already explain the failure, or nobody reads it anymore
+		if verbosity >= verboseInfo {
+			errorLog.Printf("Process ends abnormally. Reason: %v\n", err)
+		}
+	case verbosity >= verboseInfo:
+		errorLog.Printf("Process ends abnormally. Reason: %v\n", err)
+	default:
+		errorLog.Println(err)
+	}
+}
+
+// run runs the job once; as its loggers are closed with it, it reports how the process ends,
+// unless the run falls back
+func (r *Runner) run(args []string) (err error) {
+	infoWriter, errWriter, logCloser, err := openLogTarget(r.logTarget, r.logFacility)
+	if err != nil {
+		err = errors.Wrap(err, "cannot open log target")
+		reportEnd(r.log, r.errLog, r.verbosity, err)
+		return err
+	}
+	// the run id correlates the log lines with the container's RUNONCE_RUN_ID and labels
+	runID := newRunID()
+	r.log = mlog.WithPrefix(runID[:8], mlog.NewWriterLogger(infoWriter))
+	r.errLog = mlog.WithPrefix(runID[:8], mlog.NewWriterLogger(errWriter))
+	defer func() {
+		if r.fallsBack(err) {
+			r.log.Printf("run failed (%v), falling back to image %s\n", err, r.fallbackImage)
+		} else {
+			reportEnd(r.log, r.errLog, r.verbosity, err)
+		}
+		logCloser.Close()
+	}()
+
+	if r.quiet {
+		if r.verbosity > 0 {
+			return errors.New("--quiet and --verbose are mutually exclusive")
+		}
+		r.log = mlog.NewWriterLogger(ioutil.Discard)
+	}
+
+	if r.remoteAddr != "" {
+		return r.runRemote(args)
+	}
+	switch {
+	case r.pickStrategy != "" && r.pickStrategy != "least-loaded":
+		return errors.Errorf("invalid --pick value '%s'", r.pickStrategy)
+	case r.pickStrategy != "" && len(r.daemonHosts) == 0:
+		return errors.New("--pick requires --hosts")
+	case r.pickStrategy != "":
+		if err := r.pickLeastLoaded(context.Background()); err != nil {
+			return err
+		}
+	case len(r.daemonHosts) > 0:
+		return r.runOnHosts(args)
+	}
+
+	if r.sliceScope {
+		if r.cgroupSlice == "" {
+			return errors.New("--slice-scope requires --slice")
+		}
+		if os.Geteuid() != 0 {
+			// the scope of a user manager would not be below the system slice the container is in
+			return errors.New("--slice-scope requires root")
+		}
+		if scoped, err := r.runInScope(args); err != nil || scoped {
+			return err
+		}
+	}
+
+	if r.pingURL != "" {
+		// a run falling back pings once, started by the first attempt and done by the fallback
+		if !r.fallbackAttempt {
+			r.pingStart()
+		}
+		defer func() {
+			if !r.fallsBack(err) {
+				r.pingDone(exitCode(err), err)
+			}
+		}()
+	}
+	r.setDebugPhase("connecting")
+
+	if r.resultFormat != "" {
+		if _, err := r.parseResultFormat(); err != nil {
+			return err
+		}
+	}
+
+	if r.outputDigest != "" {
+		if _, err := newOutputDigest(r.outputDigest); err != nil {
+			return err
+		}
+	}
+
+	var failRe, successRe *regexp.Regexp
+	if r.failOnRegex != "" {
+		if failRe, err = regexp.Compile(r.failOnRegex); err != nil {
+			return errors.Wrap(err, "invalid --fail-on-regex")
+		}
+	}
+	if r.successRegex != "" {
+		if successRe, err = regexp.Compile(r.successRegex); err != nil {
+			return errors.Wrap(err, "invalid --success-regex")
+		}
+	}
+
+	if r.jobFile != "" {
+		if args, err = r.applyJobFile(args); err != nil {
+			return err
+		}
+	}
+	if r.profileName != "" {
+		if args, err = r.applyProfile(args); err != nil {
+			return err
+		}
+	}
+
+	if r.imageName == "" {
 		return errors.New("image-name not specified")
 	}
-	if !strings.Contains(imageName, ":") {
-		imageName += ":latest"
+	if !strings.Contains(r.imageName, ":") {
+		r.imageName += ":latest"
+	}
+	// started once the image is final, after the job file, the profile and the tag default
+	if r.debugListen != "" {
+		srv, err := r.startDebugServer(runID, r.imageName)
+		if err != nil {
+			return errors.Wrap(err, "cannot start debug server")
+		}
+		defer srv.Close()
+	}
+
+	if r.backendName != "docker" {
+		return r.runOnBackend(runID, args)
+	}
+
+	script, err := r.readScript()
+	if err != nil {
+		return err
+	}
+
+	if r.eventsTarget != "" {
+		sink, err := openEventSink(r.eventsTarget)
+		if err != nil {
+			return errors.Wrap(err, "cannot open events target")
+		}
+		r.runEvents = sink
+		defer r.runEvents.Close()
+	}
+
+	if r.noTTY && r.forceTTY {
+		return errors.New("--no-tty and --force-tty are mutually exclusive")
+	}
+	if !r.changed("color") {
+		r.colorOutput = r.stdinListen == "" && r.stdoutFile == "" && r.autoColor()
+	}
+
+	if err := r.checkCleanupOptions(r.changed("rm")); err != nil {
+		return err
+	}
+
+	switch r.stdinMode {
+	case "none", "pipe", "interactive":
+	default:
+		return errors.Errorf("invalid --stdin value '%s'", r.stdinMode)
 	}
 
-	optionRegexp, err := regexp.Compile("^" + regexp.QuoteMeta(optionLabelPrefix) + "(.+)$")
+	if r.disambiguate != "" && r.disambiguate != "latest" {
+		return errors.Errorf("invalid --disambiguate value '%s'", r.disambiguate)
+	}
+	captureDirs, err := parseCaptureDirs(r.captureDirSpecs)
+	if err != nil {
+		return err
+	}
+	var ioRate uint64
+	if r.ioRateLimit != "" {
+		if ioRate, err = parseRate(r.ioRateLimit); err != nil {
+			return errors.Wrapf(err, "invalid --io-rate-limit '%s'", r.ioRateLimit)
+		}
+	}
+	mailTailSize, err := r.checkMailOptions()
+	if err != nil {
+		return err
+	}
+	if err := r.checkScanOptions(); err != nil {
+		return err
+	}
+	if err := r.checkAttestationOptions(); err != nil {
+		return err
+	}
+
+	switch r.onConflict {
+	case "attach", "wait", "fail":
+	default:
+		return errors.Errorf("invalid --on-conflict value '%s'", r.onConflict)
+	}
+
+	if r.dedupeWindow > 0 {
+		if !r.historyEnabled {
+			return errors.New("--dedupe-window requires --history")
+		}
+		previous, err := findRecentSuccess(r.imageName, argsHash(args), r.dedupeKey, r.dedupeWindow)
+		if err != nil {
+			return errors.Wrap(err, "cannot check run history")
+		}
+		if previous != nil {
+			reason := fmt.Sprintf("identical run %s succeeded at %s, not running again",
+				previous.RunID, previous.End.Local().Format(time.RFC3339))
+			if r.dedupeExitCode != 0 {
+				return &exitCodeError{code: r.dedupeExitCode, reason: reason}
+			}
+			r.log.Println(reason)
+			return nil
+		}
+	}
+
+	optionRegexp, err := regexp.Compile("^" + regexp.QuoteMeta(r.optionLabelPrefix) + "(.+)$")
 	if err != nil {
 		return err
 	}
@@ -71,22 +355,34 @@ func run(cmd *cobra.Command, args []string) error {
 	defer cancel()
 
 	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, os.Interrupt)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signalCh)
 	go func() {
 		for {
 			select {
 			case sig := <-signalCh:
-				fmt.Printf("received signal %s\n", sig)
+				r.log.Printf("received signal %s\n", sig)
 				cancel()
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
+	if r.tieToParent {
+		go r.watchParent(ctx, cancel)
+	}
+
+	if !r.fallbackAttempt {
+		if err := r.sleepSplay(ctx); err != nil {
+			return err
+		}
+	}
 
-	dlog := mlog.WithPrefix("Docker", log)
-	if verbose {
+	dlog := mlog.WithPrefix("Docker", r.log)
+	if r.verbosity >= verboseInfo {
 		dlog.Println("connecting to docker engine...")
 	}
-	docker, err := docker_cli.NewEnvClient()
+	docker, err := r.newDockerClient()
 	if err != nil {
 		return err
 	}
@@ -96,68 +392,267 @@ func run(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	if verbose {
+	if r.verbosity >= verboseInfo {
 		dlog.Printf("connected, api version = %s", ping.APIVersion)
 	}
+	windowsDaemon := ping.OSType == "windows"
 
-	if strings.Contains(imageName, "/") {
-		if verbose {
-			dlog.Printf("pulling %s", imageName)
-		}
-		resp, err := docker.ImagePull(ctx, imageName, docker_t.ImagePullOptions{})
-		if err != nil {
+	if r.minFreeSpace != "" {
+		if err := r.checkFreeSpace(ctx, docker); err != nil {
 			return err
 		}
-		if err = responses.ParseStreamBody(resp, dlog); err != nil {
+	}
+
+	r.setDebugPhase("pulling")
+	if r.loadImage != "" {
+		if err := r.loadImages(ctx, docker, r.loadImage); err != nil {
 			return err
 		}
+	} else {
+		// wasm modules are published for their own platform; sidecars are pulled for the daemon's
+		if _, wasm := resolveRuntime(r.containerRuntime); wasm {
+			r.pullPlatform = wasmPlatform
+		}
+		err := r.pullImage(ctx, docker, r.imageName)
+		r.pullPlatform = ""
+		if err != nil {
+			return infrastructureError{err}
+		}
 	}
 
-	filters := filters.NewArgs()
-	filters.Add("reference", imageName)
-	imageSummaries, err := docker.ImageList(ctx, docker_t.ImageListOptions{
-		Filters: filters,
-	})
-	if err != nil {
+	var imageSummary docker_t.ImageSummary
+	if imageSummary, r.imageName, err = r.locateImage(ctx, docker, r.imageName); err != nil {
 		return err
 	}
 
-	if len(imageSummaries) != 1 {
-		return errors.Errorf("could not locate image '%s'", imageName)
+	result := &runResult{
+		RunID:       runID,
+		Image:       r.imageName,
+		ImageDigest: imageSummary.ID,
+		Args:        args,
+		Start:       time.Now(),
+	}
+	if len(imageSummary.RepoDigests) > 0 {
+		result.ImageDigest = imageSummary.RepoDigests[0]
+	}
+	result.Host, _ = os.Hostname()
+	result.DaemonHost = r.pickedHost
+	defer func() { r.finishRun(result, err) }()
+
+	if len(r.requireAttestation) > 0 {
+		if err := r.verifyAttestations(ctx, r.imageName, imageSummary.RepoDigests); err != nil {
+			return err
+		}
+	}
+	if r.scanImage {
+		if err := r.checkScan(ctx, r.imageName, imageSummary.ID); err != nil {
+			return err
+		}
 	}
-	imageSummary := imageSummaries[0]
 
-	for label, value := range imageSummary.Labels {
+	var labelArgs, labelEntrypoint []string
+	imageLabels := imageSummary.Labels
+	if r.ignoreLabels {
+		imageLabels = nil
+	}
+	for label, value := range imageLabels {
 		if m := optionRegexp.FindStringSubmatch(label); m != nil {
+			if r.strictLabels {
+				if err := r.validateLabelOption(m[1], value); err != nil {
+					return err
+				}
+			}
+			if flag, ok := labelOptionFlags[m[1]]; ok && r.changed(flag) {
+				if r.verbosity >= verboseDebug {
+					r.log.Printf("image label option %s ignored, --%s was given\n", m[1], flag)
+				}
+				continue
+			}
+			if r.verbosity >= verboseDebug {
+				r.log.Printf("image label option %s = %q\n", m[1], value)
+			}
 			switch m[1] {
 			case "MEMORY_LIMIT":
-				memoryLimit = value
+				r.memoryLimit = value
 			case "BIND_CWD":
-				bindCwd = value
+				r.bindCwd = value
 			case "TIMEOUT":
-				timeout = value
+				r.timeout = value
+			case "TIMEOUT_MAX":
+				r.timeoutMax = value
 			case "CONCURRENT":
-				concurrentExecution = value == "true"
+				r.concurrentExecution = value == "true"
+			case "RUNTIME":
+				r.containerRuntime = value
+			case "CPUS":
+				r.cpus = value
+			case "MEMORY_SWAP":
+				r.memorySwap = value
+			case "MEMORY_RESERVATION":
+				r.memoryReservation = value
+			case "MEMORY_SWAPPINESS":
+				if r.memorySwappiness, err = strconv.Atoi(value); err != nil {
+					return errors.Wrapf(err, "invalid memory swappiness label '%s'", value)
+				}
+			case "STOP_SIGNAL":
+				r.stopSignal = value
+			case "WINDOW":
+				r.runWindow = value
+			case "MAP_EXIT_CODE":
+				r.exitCodeMappings = append(r.exitCodeMappings, value)
+			case "ARGS":
+				if len(args) == 0 {
+					if labelArgs, err = parseLabelList(value); err != nil {
+						return errors.Wrapf(err, "invalid args label '%s'", value)
+					}
+				}
+			case "ENTRYPOINT":
+				if len(args) == 0 {
+					if labelEntrypoint, err = parseLabelList(value); err != nil {
+						return errors.Wrapf(err, "invalid entrypoint label '%s'", value)
+					}
+				}
 			}
 		}
 	}
+	if r.exitCodeMap, err = parseExitCodeMap(r.exitCodeMappings); err != nil {
+		return err
+	}
+	if r.stopSignal != "" && !signalRegexp.MatchString(r.stopSignal) {
+		return errors.Errorf("invalid stop signal '%s'", r.stopSignal)
+	}
+	if r.runWindow != "" {
+		if err := r.checkWindow(ctx, r.runWindow); err != nil {
+			return err
+		}
+	}
+	// label defaults only apply to bare invocations
+	if labelArgs != nil {
+		args = labelArgs
+		result.Args = args
+	}
+
+	// relative limits are resolved against the capacity of the daemon's host
+	var hostInfo docker_t.Info
+	if isHostRelative(r.memoryLimit) || isHostRelative(r.cpus) {
+		if hostInfo, err = docker.Info(ctx); err != nil {
+			return errors.Wrap(err, "cannot query host capacity")
+		}
+	}
 
-	memoryLimitBytes, err := humanize.ParseBytes(memoryLimit)
+	memoryLimitBytes, err := parseMemorySize(r.memoryLimit, &hostInfo)
 	if err != nil {
-		return errors.Wrapf(err, "invalid memory limit '%s'", memoryLimit)
+		return errors.Wrapf(err, "invalid memory limit '%s'", r.memoryLimit)
+	}
+	if memoryLimitBytes > 0 {
+		floor, err := humanize.ParseBytes(r.memoryFloor)
+		if err != nil {
+			return errors.Wrapf(err, "invalid memory floor '%s'", r.memoryFloor)
+		}
+		if hostInfo.MemTotal == 0 {
+			// only for the warning, the limit itself does not depend on it
+			hostInfo, _ = docker.Info(ctx)
+		}
+		r.checkMemoryLimit(memoryLimitBytes, floor, &hostInfo)
 	}
 
-	runTimeout, err := time.ParseDuration(timeout)
+	nanoCPUs, err := parseCPUs(r.cpus, &hostInfo)
 	if err != nil {
-		return errors.Wrapf(err, "invalid run timeout '%s'", timeout)
+		return errors.Wrapf(err, "invalid cpus '%s'", r.cpus)
+	}
+	cpuShares, blkioWeight, err := parsePresets(r.cpuSharesPreset, r.blkioWeightPreset)
+	if err != nil {
+		return err
 	}
 
-	if verbose {
-		log.Printf("run timeout = %s, memory limit = %s, concurrent execution = %t\n",
-			runTimeout.String(), humanize.IBytes(memoryLimitBytes), concurrentExecution)
+	// the reservation defaults to the hard limit
+	memoryReservationBytes := memoryLimitBytes
+	if r.memoryReservation != "" {
+		if memoryReservationBytes, err = humanize.ParseBytes(r.memoryReservation); err != nil {
+			return errors.Wrapf(err, "invalid memory reservation '%s'", r.memoryReservation)
+		}
+	}
+
+	// -1 allows unlimited swap, unset leaves it to the daemon (twice the memory limit)
+	var memorySwapBytes int64
+	if r.memorySwap == "-1" {
+		memorySwapBytes = -1
+	} else if r.memorySwap != "" {
+		swap, err := humanize.ParseBytes(r.memorySwap)
+		if err != nil {
+			return errors.Wrapf(err, "invalid memory swap '%s'", r.memorySwap)
+		}
+		memorySwapBytes = int64(swap)
 	}
 
-	if !concurrentExecution {
+	var memorySwappinessPtr *int64
+	if r.memorySwappiness >= 0 {
+		if r.memorySwappiness > 100 {
+			return errors.Errorf("invalid memory swappiness %d, expected 0-100", r.memorySwappiness)
+		}
+		swappiness := int64(r.memorySwappiness)
+		memorySwappinessPtr = &swappiness
+	}
+
+	runTimeout, err := parseTimeout(r.timeout)
+	if err != nil {
+		return errors.Wrap(err, "invalid run timeout")
+	}
+	if runTimeout, err = r.capTimeout(runTimeout, r.timeoutMax); err != nil {
+		return err
+	}
+
+	if r.verbosity >= verboseInfo {
+		memoryLimitText := "none"
+		if memoryLimitBytes > 0 {
+			memoryLimitText = r.formatBytes(memoryLimitBytes)
+		}
+		r.log.Printf("run timeout = %s, memory limit = %s, concurrent execution = %t\n",
+			r.formatDuration(runTimeout), memoryLimitText, r.concurrentExecution)
+	}
+
+	var shmSizeBytes uint64
+	if r.shmSize != "" {
+		if shmSizeBytes, err = humanize.ParseBytes(r.shmSize); err != nil {
+			return errors.Wrapf(err, "invalid shm size '%s'", r.shmSize)
+		}
+	}
+
+	sysctlMap := make(map[string]string)
+	for _, sysctl := range r.sysctls {
+		kv := strings.SplitN(sysctl, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return errors.Errorf("invalid sysctl '%s', expected name=value", sysctl)
+		}
+		sysctlMap[kv[0]] = kv[1]
+	}
+
+	var sidecarSpecs []sidecarSpec
+	for _, s := range r.sidecars {
+		spec, err := parseSidecar(s)
+		if err != nil {
+			return err
+		}
+		if err := r.pullImage(ctx, docker, spec.image); err != nil {
+			return errors.Wrapf(err, "cannot pull sidecar image '%s'", spec.image)
+		}
+		sidecarSpecs = append(sidecarSpecs, spec)
+	}
+
+	if r.cgroupSlice != "" {
+		if err := r.checkSlice(ctx, docker); err != nil {
+			return err
+		}
+		r.cgroupParent = r.cgroupSlice
+	}
+
+	// only for an explicit reservation, the default one is the hard limit and needs no explanation
+	if r.memoryReservation != "" && r.hostUsesCgroupV2() {
+		r.log.Println("cgroup v2 host: the memory reservation becomes memory.low, protecting that much container memory from reclaim")
+	}
+
+	var lockKey string
+	if !r.concurrentExecution {
 		exePath, err := os.Executable()
 		if err != nil {
 			return err
@@ -170,156 +665,693 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 
 		if !locked {
-			return errors.New("another instance is already running")
+			switch r.onConflict {
+			case "attach":
+				return r.attachRunning(ctx, docker, map[string]string{labelImage: r.imageName})
+			case "wait":
+				r.log.Println("another instance is already running, waiting for it to finish")
+				if _, err := lock.TryLockContext(ctx, time.Second); err != nil {
+					return err
+				}
+			default:
+				return ErrLockHeld
+			}
 		}
 		defer lock.Unlock()
+
+		// a killed instance released the lock, but its container may still run
+		orphanId, err := orphanedContainer(ctx, docker, exePath)
+		if err != nil {
+			return err
+		}
+		if orphanId != "" {
+			switch r.onConflict {
+			case "attach":
+				return r.attachRunning(ctx, docker, map[string]string{labelLockKey: lockKeyHash(exePath)})
+			case "wait":
+				r.log.Printf("container %s of an earlier instance is still running, waiting for it to finish\n", orphanId)
+				if err := waitForContainer(ctx, docker, orphanId); err != nil {
+					return err
+				}
+			default:
+				return errors.Wrapf(ErrLockHeld, "container %s of an earlier instance is still running", orphanId)
+			}
+		}
+
+		lockKey = exePath
+		if err := writeLockState(lockKey, lockState{RunID: runID, PID: os.Getpid(), Start: result.Start}); err != nil {
+			return errors.Wrap(err, "cannot write lock state")
+		}
+		defer removeLockState(lockKey)
+	}
+
+	// the container's stdio, unless served over a connection; accepted before the run timeout starts,
+	// waiting for the client is not part of the job's time
+	var stdio io.Writer = os.Stdout
+	if r.stdinListen != "" && r.scriptFromStdin {
+		return errors.New("--stdin-listen and --script are mutually exclusive")
 	}
+	conn, err := r.stdioConn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot accept stdin connection")
+	}
+	if conn != nil {
+		defer conn.Close()
+		r.containerStdin, stdio = conn, conn
+	}
+	stdoutPipe := newBrokenPipeWriter(stdio)
+	stdio = stdoutPipe
 
-	ctx, _ = context.WithTimeout(ctx, runTimeout)
+	if runTimeout > 0 {
+		ctx, _ = context.WithTimeout(ctx, runTimeout)
+	}
 
 	oomKillDisable := false
 
+	// Windows containers have no host network; the default becomes the daemon's default, nat
+	if windowsDaemon && r.networkName == "host" && !r.changed("network") {
+		r.networkName = "nat"
+	}
+	networkingConfig, err := endpointConfig(r.networkName, r.ipAddress, r.ip6Address)
+	if err != nil {
+		return err
+	}
+
+	// a kept container keeps the network and workspace it uses
+	containerKept := false
+	networkMode := container.NetworkMode(r.networkName)
+	if r.networkName == "ephemeral" {
+		name, err := r.createEphemeralNetwork(ctx, docker, runID)
+		if err != nil {
+			return errors.Wrap(err, "cannot create network")
+		}
+		// deferred before any container is created, so it runs after they are removed
+		defer func() {
+			if !containerKept {
+				r.removeNetwork(docker, name)
+			}
+		}()
+		networkMode = container.NetworkMode(name)
+	}
+
 	volumes := make(map[string]struct{})
-	var binds []string
+	for _, d := range captureDirs {
+		volumes[d.container] = struct{}{}
+	}
+	binds := append([]string(nil), r.volumeBinds...)
 	var mounts []mount.Mount
 
-	if bindCwd != "" {
+	userns, err := r.containerUsernsMode()
+	if err != nil {
+		return err
+	}
+	containerIso, err := r.containerIsolation(windowsDaemon)
+	if err != nil {
+		return err
+	}
+	if windowsDaemon && r.bindCwd == "/host" {
+		r.bindCwd = windowsBindCwd
+	}
+
+	if r.bindCwd != "" {
 		cwd, err := os.Getwd()
 		if err != nil {
 			return err
 		}
+		if userns != "host" {
+			r.warnRemappedBind(ctx, docker, &hostInfo, cwd)
+		}
 
 		mounts = append(mounts, mount.Mount{
 			Type:     "bind",
 			Source:   cwd,
-			Target:   bindCwd,
+			Target:   r.bindCwd,
 			ReadOnly: false,
 		})
 	}
 
-	resp, err := docker.ContainerCreate(ctx, &container.Config{
+	if r.workspacePath != "" {
+		workspace, werr := createWorkspace(ctx, docker, "runonce-ws-"+runID[:8], runID)
+		if werr != nil {
+			return werr
+		}
+		// registered before the container cleanup, so it runs after the container is gone
+		defer func() {
+			if !containerKept {
+				r.removeWorkspace(docker, workspace)
+			}
+		}()
+		mounts = append(mounts, mount.Mount{Type: "volume", Source: workspace, Target: r.workspacePath})
+	}
+
+	var tmpfs map[string]string
+	if r.readOnlyRoot {
+		if windowsDaemon {
+			return errors.New("--read-only is not supported for Windows containers")
+		}
+		if tmpfs, err = r.readOnlyTmpfs(ctx, docker, r.imageName, binds, mounts); err != nil {
+			return err
+		}
+	}
+
+	// a post-exec step and captured directories need the exited container, so it is removed during cleanup instead;
+	// so is it on daemons too old to wait for the removal, where AutoRemove races reading the exit status
+	autoRemove := r.rmMode == "always" && r.postExec == "" && len(captureDirs) == 0
+	if autoRemove && !supportsWaitRemoved(docker, ping) {
+		if r.verbosity >= verboseInfo {
+			dlog.Printf("api version %s cannot wait for removal, removing the container after its exit\n", ping.APIVersion)
+		}
+		autoRemove = false
+	}
+
+	cmdArgs, uploads, stdinUploaded, err := r.expandFileArgs(args)
+	if err != nil {
+		return err
+	}
+
+	config := &container.Config{
 		AttachStdin:     true,
 		AttachStdout:    true,
 		AttachStderr:    true,
 		Tty:             false,
 		OpenStdin:       true,
 		StdinOnce:       true,
-		Cmd:             args,
-		Image:           imageName,
+		Env:             append(r.envVars, "RUNONCE_RUN_ID="+runID),
+		Cmd:             cmdArgs,
+		Image:           r.imageName,
 		Volumes:         volumes,
 		NetworkDisabled: false,
-		StopTimeout:     &stopTimeout,
-	}, &container.HostConfig{
+		StopTimeout:     &r.stopTimeout,
+		StopSignal:      r.stopSignal,
+		Labels:          r.managedLabels(runID, r.imageName, args),
+		MacAddress:      r.macAddress,
+	}
+	if lockKey != "" {
+		config.Labels[labelLockKey] = lockKeyHash(lockKey)
+	}
+	if runTimeout > 0 {
+		config.Labels[labelTimeout] = runTimeout.String()
+	}
+	switch r.stdinMode {
+	case "none":
+		config.AttachStdin, config.OpenStdin, config.StdinOnce = false, false, false
+	case "interactive":
+		// the container's stdin stays open when ours ends or we detach
+		config.StdinOnce = false
+	}
+	if labelEntrypoint != nil {
+		config.Entrypoint = labelEntrypoint
+	}
+	if script != nil {
+		config.Entrypoint = []string{"/bin/sh", scriptPath}
+		// stdin held the script
+		if r.scriptFromStdin {
+			config.AttachStdin, config.OpenStdin, config.StdinOnce = false, false, false
+		}
+	}
+	if stdinUploaded {
+		// stdin was uploaded for @-
+		config.AttachStdin, config.OpenStdin, config.StdinOnce = false, false, false
+	}
+	if r.shellWrap {
+		if script != nil || windowsDaemon {
+			return errors.New("--shell cannot be used with --script or for Windows containers")
+		}
+		config.Entrypoint, config.Cmd = shellCommand(cmdArgs)
+	}
+	runtimeName, wasm := resolveRuntime(r.containerRuntime)
+	if wasm && r.verbosity >= verboseInfo {
+		r.log.Printf("running wasm module with runtime %s\n", runtimeName)
+	}
+	hostConfig := &container.HostConfig{
 		Binds:          binds,
-		NetworkMode:    "host",
+		NetworkMode:    networkMode,
 		RestartPolicy:  container.RestartPolicy{Name: "no"},
-		AutoRemove:     true,
+		AutoRemove:     autoRemove,
 		VolumeDriver:   "local",
 		OomScoreAdj:    1000,
 		Privileged:     false,
-		ReadonlyRootfs: false,
+		ReadonlyRootfs: r.readOnlyRoot,
+		Tmpfs:          tmpfs,
+		Runtime:        runtimeName,
+		UsernsMode:     userns,
+		Isolation:      containerIso,
+		ShmSize:        int64(shmSizeBytes),
+		Sysctls:        sysctlMap,
 		Resources: container.Resources{
+			CgroupParent:      r.cgroupParent,
+			NanoCPUs:          nanoCPUs,
+			CPUShares:         cpuShares,
+			BlkioWeight:       blkioWeight,
 			Memory:            int64(memoryLimitBytes),
-			MemoryReservation: int64(memoryLimitBytes),
+			MemoryReservation: int64(memoryReservationBytes),
+			MemorySwap:        memorySwapBytes,
+			MemorySwappiness:  memorySwappinessPtr,
 			OomKillDisable:    &oomKillDisable,
 			PidsLimit:         128,
 		},
 		Mounts: mounts,
-	}, &network.NetworkingConfig{}, "")
+	}
+
+	if windowsDaemon {
+		adaptForWindows(hostConfig)
+	}
+
+	hookCtx := &hookContext{RunID: runID, Image: r.imageName, Args: args, Config: config, HostConfig: hostConfig}
+	if err := r.runHook("pre-create", hookCtx); err != nil {
+		return err
+	}
+	config, hostConfig = hookCtx.Config, hookCtx.HostConfig
+
+	r.setDebugPhase("creating")
+	resp, err := r.createContainer(ctx, docker, config.Image, config, hostConfig, networkingConfig)
 	if err != nil {
+		if ctx.Err() != nil {
+			// the daemon may have created the container after all
+			r.removeRunContainers(docker, runID)
+		}
 		return err
 	}
+	hookCtx.ContainerID = resp.ID
 
 	containerId := resp.ID
-	defer cleanupContainer(docker, containerId)
+	result.ContainerID = containerId
+	r.setDebugContainer(containerId)
+	defer func() {
+		if r.keepContainer(err) {
+			r.log.Printf("keeping container of the run, see 'docker-runonce logs %s'\n", runID)
+			result.Cleanup, containerKept = "kept", true
+			return
+		}
+		if herr := r.runHook("pre-remove", hookCtx); herr != nil {
+			r.log.Println(herr)
+		}
+		if cerr := r.cleanupContainer(docker, containerId); cerr != nil {
+			r.log.Printf("cannot remove container %s: %v\n", containerId, cerr)
+			result.Cleanup = "failed"
+			return
+		}
+		result.Cleanup = "removed"
+	}()
+	r.runEvents.emit(runEvent{Event: "created", Image: r.imageName, ContainerID: containerId})
+	if lockKey != "" {
+		state := lockState{RunID: runID, PID: os.Getpid(), ContainerID: containerId, Start: result.Start}
+		if err := writeLockState(lockKey, state); err != nil {
+			r.log.Printf("cannot record container in lock state: %v\n", err)
+		}
+	}
+	if len(uploads) > 0 {
+		if err := copyFileArgs(ctx, docker, containerId, uploads); err != nil {
+			return err
+		}
+	}
+	if script != nil {
+		if err := copyScript(ctx, docker, containerId, script); err != nil {
+			return err
+		}
+	} else if !windowsDaemon && !wasm {
+		if err := r.checkShellArgs(ctx, docker, containerId, cmdArgs); err != nil {
+			return err
+		}
+	}
+
+	for _, message := range resp.Warnings {
+		w := classifyWarning(message)
+		dlog.Println(w.Message)
+		if w.Hint != "" {
+			dlog.Printf("hint: %s\n", w.Hint)
+		}
+		r.ghaCommand("warning", w.Message)
+		result.Warnings = append(result.Warnings, w)
+	}
+	if r.failOnWarnings && len(resp.Warnings) > 0 {
+		return errors.Wrapf(ErrCreateWarned, "%d warning(s)", len(resp.Warnings))
+	}
 
-	for _, w := range resp.Warnings {
-		dlog.Println(w)
+	if r.verbosity >= verboseInfo {
+		dlog.Printf("container id = %s, run id = %s\n", resp.ID, runID)
 	}
 
-	if verbose {
-		dlog.Printf("container id = %s\n", resp.ID)
+	// register the wait before starting, otherwise a short-lived container may be gone before we look
+	waitCondition := container.WaitConditionRemoved
+	if !autoRemove {
+		waitCondition = container.WaitConditionNextExit
 	}
+	waitCh, waitErrCh := docker.ContainerWait(ctx, containerId, waitCondition)
 
+	if len(sidecarSpecs) > 0 {
+		sidecarIds, err := r.startSidecars(ctx, docker, sidecarSpecs, runID, containerId, networkMode, hostConfig.Resources)
+		defer r.removeContainers(docker, sidecarIds)
+		if err != nil {
+			return errors.Wrap(err, "cannot start sidecar")
+		}
+	}
+
+	go r.watchContainerEvents(ctx, docker, containerId, result)
+	if r.cpuTimeLimit > 0 {
+		go r.watchCPUTime(ctx, docker, containerId, r.cpuTimeLimit, result)
+	}
+
+	r.setDebugPhase("starting")
 	if err := docker.ContainerStart(ctx, containerId, docker_t.ContainerStartOptions{}); err != nil {
-		return err
+		return infrastructureError{err}
+	}
+	r.runEvents.emit(runEvent{Event: "started", ContainerID: containerId})
+	go watchUsage(ctx, docker, containerId, result)
+
+	if err := r.runHook("post-start", hookCtx); err != nil {
+		r.log.Println(err)
+	}
+
+	if r.heartbeat > 0 {
+		heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+		defer stopHeartbeat()
+		go r.runHeartbeat(heartbeatCtx, docker, containerId, r.heartbeat)
 	}
 
-	hr, err := docker.ContainerAttach(ctx, containerId, docker_t.ContainerAttachOptions{
-		Stream: true,
-		Stdin:  true,
-		Stdout: true,
-		Stderr: true,
-		Logs:   true,
-	})
+	prefix := outputPrefix(r.outputPrefixFormat, containerId, r.colorOutput)
+	stdoutTarget, closeStdout, err := r.outputTarget(r.stdoutFile, stdio)
 	if err != nil {
 		return err
 	}
-	defer hr.Close()
+	defer closeStdout()
+	stderrTarget := stdoutTarget
+	if r.stderrFile == "" || r.stderrFile != r.stdoutFile {
+		var closeStderr func()
+		if stderrTarget, closeStderr, err = r.outputTarget(r.stderrFile, os.Stderr); err != nil {
+			return err
+		}
+		defer closeStderr()
+	}
 
-	ah := attach.NewHandler(hr).WithStdout(os.Stdout).WithStderr(os.Stderr).WithStdin(os.Stdin)
-	defer ah.Close()
+	stdoutSink := wrapOutput(stdoutTarget, prefix, r.timestamps)
+	if r.outputDigest != "" {
+		// hashed behind the replay writer, so re-attached output is not counted twice
+		result.stdoutHash, _ = newOutputDigest(r.outputDigest)
+		stdoutSink = io.MultiWriter(stdoutSink, result.stdoutHash)
+	}
+	if r.teeStdout != "" {
+		teeOut, closeTeeOut, err := r.outputTarget(r.teeStdout, nil)
+		if err != nil {
+			return err
+		}
+		defer closeTeeOut()
+		stdoutSink = io.MultiWriter(stdoutSink, teeOut)
+	}
+	if r.teeStdin != "" {
+		teeIn, closeTeeIn, err := r.outputTarget(r.teeStdin, nil)
+		if err != nil {
+			return err
+		}
+		defer closeTeeIn()
+		r.containerStdin = io.TeeReader(r.containerStdin, teeIn)
+	}
+	result.stderrTail = newTailBuffer(stderrTailSize)
+	stderrSink := io.MultiWriter(wrapOutput(stderrTarget, prefix, r.timestamps), result.stderrTail)
+	if mailTailSize > 0 {
+		result.outputTail = newTailBuffer(mailTailSize)
+		stdoutSink = io.MultiWriter(stdoutSink, result.outputTail)
+		stderrSink = io.MultiWriter(stderrSink, result.outputTail)
+	}
+	var failMatchers, successMatchers outputMatchers
+	stdoutSink = successMatchers.watch(failMatchers.watch(stdoutSink, failRe), successRe)
+	stderrSink = successMatchers.watch(failMatchers.watch(stderrSink, failRe), successRe)
+	if ioRate > 0 {
+		// throttled behind the replay writers, so skipped replayed output is not delayed
+		outLimiter := newRateLimiter(ioRate)
+		stdoutSink = &limitedWriter{w: stdoutSink, limiter: outLimiter}
+		stderrSink = &limitedWriter{w: stderrSink, limiter: outLimiter}
+		r.containerStdin = &limitedReader{r: r.containerStdin, limiter: newRateLimiter(ioRate)}
+	}
+	stdout := &replayWriter{w: stdoutSink}
+	stderr := &replayWriter{w: stderrSink}
 
-	attachClosedCh := make(chan struct{})
-	ah.AddCloseListener(attachClosedCh)
-	ah.Start()
+	r.ghaCommand("group", strings.TrimSpace(r.imageName+" "+strings.Join(args, " ")))
+	defer r.ghaCommand("endgroup", "")
+	att, err := r.attachContainer(ctx, docker, containerId, config.OpenStdin, stdout, stderr)
+	if err != nil {
+		return err
+	}
+	defer func() { att.Close() }()
+	r.runEvents.emit(runEvent{Event: "attached", ContainerID: containerId})
+	// only the first attach carries stdin
+	stdinFlow := att.stdin
 
-	select {
-	case <-time.After(runTimeout):
-		cancel()
-	case <-attachClosedCh:
-		cancel()
-	case <-ctx.Done():
+	var timeoutCh <-chan time.Time
+	if runTimeout > 0 {
+		timeoutCh = time.After(runTimeout)
+	}
+	attachClosedCh := att.closedCh
+	reattachCount := 0
+	reattach := func() error {
+		r.setDebugPhase("reattaching")
+		att.Close()
+		// the daemon replays the whole log on a Logs attach, so skip what has already been forwarded
+		stdout.Rewind()
+		stderr.Rewind()
+		reattached, err := r.attachContainer(ctx, docker, containerId, false, stdout, stderr)
+		if err != nil {
+			return errors.Wrap(err, "re-attach failed")
+		}
+		att = reattached
+		attachClosedCh = att.closedCh
+		r.setDebugPhase("running")
+		return nil
+	}
+	r.setDebugPhase("running")
+	for {
+		select {
+		case <-stdoutPipe.broken:
+			r.log.Println("stdout was closed, stopping container")
+			stopCtx, cancelStop := context.WithTimeout(context.Background(), 10*time.Second)
+			_ = docker.ContainerStop(stopCtx, containerId, nil)
+			cancelStop()
+			return ErrBrokenPipe
+		case <-timeoutCh:
+			result.TimedOut = true
+			r.runEvents.emit(runEvent{Event: "timeout", ContainerID: containerId})
+			cancel()
+			return errors.Wrapf(ErrTimeout, "run timeout of %s exceeded", r.formatDuration(runTimeout))
+		case <-attachClosedCh:
+			attachClosedCh = nil
+			if !containerRunning(ctx, docker, containerId) {
+				// the container is done, its exit status arrives via the wait channel
+				continue
+			}
+			if reattachCount >= r.reattachRetries {
+				return errors.New("attach stream lost while the container is still running")
+			}
+			reattachCount++
+			dlog.Printf("attach stream closed while container is still running, re-attaching (%d/%d)",
+				reattachCount, r.reattachRetries)
+			if err := reattach(); err != nil {
+				return err
+			}
+		case status := <-waitCh:
+			r.setDebugPhase("exited")
+			if attachClosedCh != nil {
+				// the container is gone, but the attach stream may still hold buffered output
+				select {
+				case <-attachClosedCh:
+				case <-time.After(drainTimeout):
+					dlog.Println("timed out draining container output")
+				}
+			}
+			if status.Error != nil {
+				return errors.Errorf("waiting for container failed: %s", status.Error.Message)
+			}
+			if stdinFlow != nil {
+				if msg, ok := stdinFlow.unfinished(); ok {
+					r.log.Println(msg)
+				}
+			}
+			if r.verbosity >= verboseInfo {
+				dlog.Printf("container exited with status %d\n", status.StatusCode)
+			}
+			exitCode := int(status.StatusCode)
+			r.runEvents.emit(runEvent{Event: "exited", ContainerID: containerId, ExitCode: &exitCode})
+			if autoRemove {
+				r.runEvents.emit(runEvent{Event: "removed", ContainerID: containerId})
+			}
+			if r.postExec != "" {
+				if err := r.runPostExec(docker, containerId, networkMode, hostConfig.Resources, stdout, stderr); err != nil {
+					r.log.Printf("post-exec failed: %v\n", err)
+				}
+			}
+			if len(captureDirs) > 0 {
+				r.copyCaptureDirs(docker, containerId, captureDirs, runID, result.Start)
+			}
+			// output patterns override the exit status, a failure pattern over a success pattern
+			if failMatchers.Matched() {
+				if exitCode == 0 {
+					exitCode = 1
+				}
+				r.log.Printf("container output matched --fail-on-regex, failing with %d\n", exitCode)
+				return &exitCodeError{code: exitCode}
+			}
+			if exitCode != 0 && successMatchers.Matched() {
+				if r.verbosity >= verboseInfo {
+					dlog.Printf("exit status %d overridden by --success-regex\n", exitCode)
+				}
+				return nil
+			}
+			// an explicit mapping wins over the classification of the exit
+			if hostCode, ok := r.exitCodeMap[exitCode]; ok {
+				if r.verbosity >= verboseInfo {
+					dlog.Printf("exit status %d mapped to %d\n", exitCode, hostCode)
+				}
+				if hostCode == 0 {
+					return nil
+				}
+				return &exitCodeError{code: hostCode}
+			}
+			if result.cpuTimeExceeded() {
+				return errors.Wrapf(ErrCPUTimeLimit, "limit of %s", r.formatDuration(r.cpuTimeLimit))
+			}
+			if result.oomKilled() {
+				return errors.Wrapf(ErrOOMKilled, "container exited with status %d", exitCode)
+			}
+			if exitCode != 0 {
+				return &exitCodeError{code: exitCode}
+			}
+			return nil
+		case err := <-waitErrCh:
+			if ctx.Err() == context.DeadlineExceeded {
+				result.TimedOut = true
+				r.runEvents.emit(runEvent{Event: "timeout", ContainerID: containerId})
+				return errors.Wrapf(ErrTimeout, "run timeout of %s exceeded", r.formatDuration(runTimeout))
+			}
+			if ctx.Err() != nil {
+				return ErrCancelled
+			}
+			if docker_cli.IsErrNotFound(err) {
+				return errors.Wrap(err, "container was removed before its exit status could be read")
+			}
+			if r.reconnectTimeout <= 0 {
+				return errors.Wrap(err, "waiting for container failed")
+			}
+			// the daemon may have restarted and live-restored the container
+			dlog.Printf("lost connection to the daemon (%v), waiting for it to return", err)
+			info, rerr := r.reconnectContainer(ctx, docker, containerId)
+			if autoRemove && docker_cli.IsErrNotFound(errors.Cause(rerr)) {
+				return errors.New("container exited and was removed while the daemon was away, its exit status is unknown")
+			}
+			if rerr != nil {
+				return errors.Wrapf(rerr, "waiting for container failed (%v)", err)
+			}
+			r.runEvents.emit(runEvent{Event: "reconnected", ContainerID: containerId})
+			if info.State.Running {
+				waitCh, waitErrCh = docker.ContainerWait(ctx, containerId, waitCondition)
+				if attachClosedCh == nil {
+					if err := reattach(); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			// it exited while the daemon was away; finish like a regular exit
+			exited := make(chan container.ContainerWaitOKBody, 1)
+			exited <- container.ContainerWaitOKBody{StatusCode: int64(info.State.ExitCode)}
+			waitCh, waitErrCh = exited, nil
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				result.TimedOut = true
+				r.runEvents.emit(runEvent{Event: "timeout", ContainerID: containerId})
+				return errors.Wrapf(ErrTimeout, "run timeout of %s exceeded", r.formatDuration(runTimeout))
+			}
+			return ErrCancelled
+		}
 	}
-	return nil
 }
 
-func cleanupContainer(docker *docker_cli.Client, containerId string) {
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-	_ = docker.ContainerRemove(ctx, containerId, docker_t.ContainerRemoveOptions{
-		Force: true,
-	})
+// removeRunContainers removes what a cancelled request may have left behind for the run
+func (r *Runner) removeRunContainers(docker *docker_cli.Client, runID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cleanupTimeout)
+	defer cancel()
+	containers, err := findManagedContainers(ctx, docker, true, map[string]string{labelRunID: runID})
+	if err != nil {
+		return
+	}
+	for _, c := range containers {
+		r.cleanupContainer(docker, c.ID)
+	}
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func main() {
-	if forwardImageArgs {
+	shareRunFlags()
+	if cliOptions.forwardImageArgs {
 		rootCmd.SetArgs(append([]string{"--"}, os.Args[1:]...))
 	}
 
-	if err := rootCmd.Execute(); err != nil {
-		if verbose {
-			log.Printf("Process ends abnormally. Reason: %v\n", err)
-		} else {
-			log.Println(err)
-		}
-		if code, ok := signalerror.ErrSignalExitCode(err); ok {
-			os.Exit(code)
-		} else {
-			os.Exit(1)
-		}
+	err := rootCmd.Execute()
+	var reported *endReported
+	if errors.As(err, &reported) {
+		err = reported.err
 	} else {
-		if verbose {
-			log.Printf("Process ends normally.\n")
-		}
-		os.Exit(0)
+		reportEnd(log, errLog, cliOptions.verbosity, err)
 	}
+	os.Exit(exitCode(err))
 }
 
 func init() {
 	if exeName := filepath.Base(os.Args[0]); exeName != "" && exeName != "docker-runonce" {
-		imageName = exeName
-		forwardImageArgs = true
+		cliOptions.imageName = exeName
+		cliOptions.forwardImageArgs = true
 	}
 
 	rootCmd.Version = "1 (commit " + buildID + " built on " + buildDate + ")"
-	rootCmd.Flags().StringVar(&timeout, "timeout", "10s", "give up retrying after this time")
-	rootCmd.Flags().IntVar(&stopTimeout, "stop-timeout", 1, "stop timeout in seconds")
-	rootCmd.Flags().StringVar(&bindCwd, "bind-cwd", "/host", "target path to bind-mount current working directory")
-	rootCmd.Flags().StringVar(&memoryLimit, "memory-limit", "128Mi", "container memory limit")
-	rootCmd.Flags().StringVar(&optionLabelPrefix, "option-label-prefix", "DRO_", "prefix for image labels to use as options")
-	rootCmd.Flags().StringVar(&imageName, "image", imageName, "image name (default is executable name if != docker-runonce)")
-	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
-	rootCmd.Flags().BoolVar(&concurrentExecution, "concurrent", true, "allow concurrent execution")
+	rootCmd.Flags().StringVar(&cliOptions.timeout, "timeout", "10s", "give up retrying after this time, e.g. 90s, 2h30m or 1d12h (none disables)")
+	rootCmd.Flags().DurationVar(&cliOptions.cpuTimeLimit, "cpu-time-limit", 0, "kill the container when its processes have used this much CPU time in total")
+	rootCmd.Flags().IntVar(&cliOptions.stopTimeout, "stop-timeout", 1, "stop timeout in seconds")
+	rootCmd.Flags().StringVar(&cliOptions.failOnRegex, "fail-on-regex", "", "fail the run if a line of container output matches this regular expression")
+	rootCmd.Flags().StringVar(&cliOptions.successRegex, "success-regex", "", "succeed even with a non-zero exit status if a line of container output matches this regular expression")
+	rootCmd.Flags().StringArrayVar(&cliOptions.exitCodeMappings, "map-exit-code", nil, "exit with host code for container code, container=host, e.g. 2=0 (repeatable)")
+	rootCmd.Flags().StringVar(&cliOptions.stopSignal, "stop-signal", "", "signal stopping the container, e.g. SIGINT (default is the image's)")
+	rootCmd.Flags().StringArrayVarP(&cliOptions.envVars, "env", "e", nil, "set a container environment variable NAME=value (repeatable)")
+	rootCmd.Flags().StringArrayVar(&cliOptions.volumeBinds, "volume", nil, "bind mount host-path:container-path[:ro] (repeatable)")
+	rootCmd.Flags().StringVar(&cliOptions.bindCwd, "bind-cwd", "/host", "target path to bind-mount current working directory")
+	rootCmd.Flags().StringVar(&cliOptions.memoryLimit, "memory-limit", "128Mi", "container memory limit, absolute, percentage of host memory or none")
+	rootCmd.Flags().StringVar(&cliOptions.memoryFloor, "memory-floor", "6MiB", "warn about memory limits below this size")
+	rootCmd.Flags().StringVar(&cliOptions.cpus, "cpus", "", "container CPU limit, absolute, percentage of host CPUs or auto for all")
+	rootCmd.Flags().StringVar(&cliOptions.cpuSharesPreset, "cpu-shares-preset", "", "CPU priority relative to other containers, like nice: low, normal or high")
+	rootCmd.Flags().StringVar(&cliOptions.blkioWeightPreset, "blkio-weight-preset", "", "block IO priority relative to other containers, like ionice: low, normal or high")
+	rootCmd.Flags().StringVar(&cliOptions.containerRuntime, "runtime", "", "OCI runtime for the container, e.g. runsc, kata, nvidia or a wasm shim like wasmtime (default is the daemon's)")
+	rootCmd.Flags().StringVar(&cliOptions.cgroupParent, "cgroup-parent", "", "parent cgroup (or systemd slice) for the container")
+	rootCmd.Flags().StringVar(&cliOptions.shmSize, "shm-size", "", "size of /dev/shm (default is the daemon's)")
+	rootCmd.Flags().StringArrayVar(&cliOptions.sysctls, "sysctl", nil, "namespaced kernel parameter name=value (repeatable)")
+	rootCmd.Flags().StringVar(&cliOptions.memoryReservation, "memory-reservation", "", "container memory soft limit (default is the memory limit)")
+	rootCmd.Flags().StringVar(&cliOptions.memorySwap, "memory-swap", "", "container memory plus swap limit, -1 for unlimited swap")
+	rootCmd.Flags().IntVar(&cliOptions.memorySwappiness, "memory-swappiness", -1, "container memory swappiness 0-100 (default is the host's)")
+	rootCmd.Flags().BoolVar(&cliOptions.ignoreLabels, "ignore-labels", false, "ignore options from image labels")
+	rootCmd.Flags().BoolVar(&cliOptions.strictLabels, "strict-labels", false, "fail on unknown option labels and invalid label values")
+	rootCmd.Flags().StringVar(&cliOptions.optionLabelPrefix, "option-label-prefix", "DRO_", "prefix for image labels to use as options")
+	rootCmd.Flags().StringVar(&cliOptions.imageName, "image", cliOptions.imageName, "image name (default is executable name if != docker-runonce)")
+	rootCmd.Flags().BoolVarP(&cliOptions.quiet, "quiet", "q", false, "suppress all output except the container's own")
+	rootCmd.Flags().StringVar(&cliOptions.logTarget, "log-target", "stderr", "where to write tool messages: stderr, syslog, journald or file:/path")
+	rootCmd.Flags().StringVar(&cliOptions.logFacility, "log-facility", "user", "syslog facility for the syslog and journald log targets")
+	rootCmd.Flags().CountVarP(&cliOptions.verbosity, "verbose", "v", "verbose output (repeat for more detail, -vvv traces Docker API calls)")
+	rootCmd.Flags().BoolVar(&cliOptions.concurrentExecution, "concurrent", true, "allow concurrent execution")
+	rootCmd.Flags().StringVar(&cliOptions.outputPrefixFormat, "prefix", "", "prefix for each line of container output ({id} expands to the short container id)")
+	rootCmd.Flags().BoolVar(&cliOptions.colorOutput, "color", false, "colorize the output prefix (default: if stdout is a terminal and NO_COLOR is not set)")
+	rootCmd.Flags().StringVar(&cliOptions.stdinMode, "stdin", "pipe", "container stdin: pipe forwards ours until EOF, none attaches none, interactive keeps it open after ours ends")
+	rootCmd.Flags().StringVar(&cliOptions.teeStdin, "tee-stdin", "", "also write what is sent to the container's stdin to this file")
+	rootCmd.Flags().StringVar(&cliOptions.teeStdout, "tee-stdout", "", "also write the container's stdout to this file")
+	rootCmd.Flags().StringVar(&cliOptions.outputDigest, "output-digest", "", "compute a digest of the container's stdout (sha256 or sha512) and report it")
+	rootCmd.Flags().BoolVar(&cliOptions.timestamps, "timestamps", false, "prefix each line of container output with an RFC3339 timestamp")
+	rootCmd.Flags().DurationVar(&cliOptions.heartbeat, "heartbeat", 0, "log a progress line at this interval while the container runs")
+	rootCmd.Flags().StringVar(&cliOptions.eventsTarget, "events-json", "", "write NDJSON lifecycle events to this file or fd:N")
+	rootCmd.Flags().StringVar(&cliOptions.runName, "name", "", "name for the run, usable with the stop, kill and logs commands")
+	rootCmd.Flags().BoolVar(&cliOptions.keepOnError, "keep-on-error", false, "keep the container of a failed run for inspection with the logs command, same as --rm=on-success")
+	rootCmd.Flags().StringVar(&cliOptions.networkName, "network", "host", "network for the container; ephemeral creates a private network for the run, removed with the container")
+	rootCmd.Flags().StringVar(&cliOptions.ipAddress, "ip", "", "IPv4 address on a user-defined network")
+	rootCmd.Flags().StringVar(&cliOptions.ip6Address, "ip6", "", "IPv6 address on a user-defined network")
+	rootCmd.Flags().StringVar(&cliOptions.macAddress, "mac-address", "", "container MAC address")
+	rootCmd.Flags().StringArrayVar(&cliOptions.sidecars, "sidecar", nil, "helper container \"image [cmd...]\" sharing the job's network and volumes (repeatable)")
+	rootCmd.Flags().StringVar(&cliOptions.postExec, "post-exec", "", "shell command to run on the container's filesystem after the main command exits")
+	rootCmd.Flags().DurationVar(&cliOptions.postExecTimeout, "post-exec-timeout", time.Minute, "time limit for the post-exec command")
+	rootCmd.Flags().StringVar(&cliOptions.onConflict, "on-conflict", "fail", "with --concurrent=false, what to do if another instance runs: attach, wait or fail")
+	rootCmd.Flags().DurationVar(&cliOptions.reconnectTimeout, "daemon-reconnect-timeout", time.Minute, "wait this long for a restarting daemon before giving up on the run (0 gives up at once)")
+	rootCmd.Flags().IntVar(&cliOptions.reattachRetries, "reattach-retries", 3, "re-attach this many times if the attach stream drops while the container is running")
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var stopCmd = &cobra.Command{
+	Use:   "stop <name|run-id>...",
+	Short: "stop managed runs",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runnerCommand((*Runner).stopRuns),
+}
+
+var killCmd = &cobra.Command{
+	Use:   "kill <name|run-id>...",
+	Short: "kill managed runs",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runnerCommand((*Runner).killRuns),
+}
+
+// findRuns resolves a run reference to the running managed containers it names
+func findRuns(ctx context.Context, docker *docker_cli.Client, ref string) ([]docker_t.Container, error) {
+	containers, err := findManagedContainers(ctx, docker, false, map[string]string{labelRunID: ref})
+	if err != nil || len(containers) > 0 {
+		return containers, err
+	}
+	containers, err = findManagedContainers(ctx, docker, false, map[string]string{labelName: ref})
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) == 0 {
+		return nil, errors.Errorf("no running run named '%s'", ref)
+	}
+	return containers, nil
+}
+
+// forEachRun applies fn to the containers of all referenced runs
+func (r *Runner) forEachRun(refs []string, fn func(ctx context.Context, docker *docker_cli.Client, containerId string) error) error {
+	docker, err := r.newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer docker.Close()
+
+	ctx := context.Background()
+	for _, ref := range refs {
+		containers, err := findRuns(ctx, docker, ref)
+		if err != nil {
+			return err
+		}
+		for _, c := range containers {
+			if err := fn(ctx, docker, c.ID); err != nil {
+				return errors.Wrapf(err, "run '%s'", ref)
+			}
+			r.log.Printf("%s: %s\n", ref, c.ID)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) stopRuns(cmd *cobra.Command, args []string) error {
+	return r.forEachRun(args, func(ctx context.Context, docker *docker_cli.Client, containerId string) error {
+		// without an explicit grace period, the daemon uses the stop timeout the run was created with
+		var timeout *time.Duration
+		if r.stopGracePeriod >= 0 {
+			d := time.Duration(r.stopGracePeriod) * time.Second
+			timeout = &d
+		}
+		return docker.ContainerStop(ctx, containerId, timeout)
+	})
+}
+
+func (r *Runner) killRuns(cmd *cobra.Command, args []string) error {
+	return r.forEachRun(args, func(ctx context.Context, docker *docker_cli.Client, containerId string) error {
+		return docker.ContainerKill(ctx, containerId, r.killSignal)
+	})
+}
+
+func init() {
+	stopCmd.Flags().IntVarP(&cliOptions.stopGracePeriod, "time", "t", -1, "seconds to wait before killing (default is the run's stop timeout)")
+	killCmd.Flags().StringVarP(&cliOptions.killSignal, "signal", "s", "KILL", "signal to send")
+	rootCmd.AddCommand(stopCmd, killCmd)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/network"
+	"github.com/pkg/errors"
+)
+
+// isUserDefinedNetwork reports whether the network accepts endpoint settings like static addresses
+func isUserDefinedNetwork(name string) bool {
+	switch name {
+	case "host", "bridge", "nat", "default", "none", "ephemeral":
+		return false
+	}
+	return !strings.HasPrefix(name, "container:")
+}
+
+// endpointConfig builds the networking config carrying static addresses for the job container
+func endpointConfig(networkName, ip, ip6 string) (*network.NetworkingConfig, error) {
+	if ip == "" && ip6 == "" {
+		return &network.NetworkingConfig{}, nil
+	}
+	if !isUserDefinedNetwork(networkName) {
+		return nil, errors.Errorf("static addresses require a user-defined network, not '%s'", networkName)
+	}
+	if ip != "" && net.ParseIP(ip).To4() == nil {
+		return nil, errors.Errorf("invalid IPv4 address '%s'", ip)
+	}
+	if ip6 != "" && (net.ParseIP(ip6) == nil || net.ParseIP(ip6).To4() != nil) {
+		return nil, errors.Errorf("invalid IPv6 address '%s'", ip6)
+	}
+
+	return &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			networkName: {
+				IPAMConfig: &network.EndpointIPAMConfig{
+					IPv4Address: ip,
+					IPv6Address: ip6,
+				},
+			},
+		},
+	}, nil
+}
+
+// createEphemeralNetwork creates a bridge network used only by this run and its sidecars
+func (r *Runner) createEphemeralNetwork(ctx context.Context, docker *docker_cli.Client, runID string) (string, error) {
+	name := "runonce-" + runID[:8]
+	resp, err := docker.NetworkCreate(ctx, name, docker_t.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Labels: map[string]string{
+			labelManaged: "true",
+			labelRunID:   runID,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.Warning != "" {
+		r.log.Println(resp.Warning)
+	}
+	if r.verbosity >= verboseInfo {
+		r.log.Printf("created network %s\n", name)
+	}
+	return name, nil
+}
+
+func (r *Runner) removeNetwork(docker *docker_cli.Client, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cleanupTimeout)
+	defer cancel()
+	if err := docker.NetworkRemove(ctx, name); err != nil {
+		r.log.Printf("cannot remove network %s: %v\n", name, err)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// nomadPollInterval is how often the allocation of a Nomad job is checked
+const nomadPollInterval = time.Second
+
+// nomadTask names the single task of the submitted job
+const nomadTask = "job"
+
+// nomadClient talks to the Nomad HTTP API, configured like the nomad CLI by NOMAD_ADDR,
+// NOMAD_TOKEN and NOMAD_NAMESPACE
+type nomadClient struct {
+	addr      string
+	token     string
+	namespace string
+	http      *http.Client
+	log       printfLogger
+}
+
+func newNomadClient(log printfLogger) *nomadClient {
+	addr := os.Getenv("NOMAD_ADDR")
+	if addr == "" {
+		addr = "http://127.0.0.1:4646"
+	}
+	return &nomadClient{
+		addr:      strings.TrimSuffix(addr, "/"),
+		token:     os.Getenv("NOMAD_TOKEN"),
+		namespace: os.Getenv("NOMAD_NAMESPACE"),
+		http:      &http.Client{},
+		log:       log,
+	}
+}
+
+// request sends a request to path and decodes a JSON response into out, if given
+func (c *nomadClient) request(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	resp, err := c.open(ctx, method, path, query, body)
+	if err != nil {
+		return errors.Wrap(err, "nomad")
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *nomadClient) open(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.namespace != "" {
+		query.Set("namespace", c.namespace)
+	}
+	header := http.Header{}
+	if c.token != "" {
+		header.Set("X-Nomad-Token", c.token)
+	}
+	return apiOpen(ctx, c.http, method, c.addr+path+"?"+query.Encode(), header, body)
+}
+
+type nomadAllocation struct {
+	ID           string
+	ClientStatus string
+	TaskStates   map[string]struct {
+		State  string
+		Failed bool
+		Events []struct {
+			Type           string
+			ExitCode       int
+			DisplayMessage string
+		}
+	}
+}
+
+// nomadJob maps the spec onto a batch job that is neither restarted nor rescheduled;
+// Nomad counts CPU in MHz, one CPU is taken as 1000 MHz
+func (r *Runner) nomadJob(spec *backendJob, jobID string) map[string]interface{} {
+	resources := map[string]interface{}{}
+	if spec.MemoryBytes > 0 {
+		resources["MemoryMB"] = (spec.MemoryBytes + 1<<20 - 1) >> 20
+	}
+	if spec.NanoCPUs > 0 {
+		resources["CPU"] = spec.NanoCPUs / 1e6
+	}
+	config := map[string]interface{}{"image": spec.Image}
+	if len(spec.Args) > 0 {
+		config["args"] = spec.Args
+	}
+	return map[string]interface{}{
+		"ID":          jobID,
+		"Name":        jobID,
+		"Type":        "batch",
+		"Datacenters": r.nomadDatacenters,
+		"Meta":        map[string]string{labelRunID: spec.RunID},
+		"TaskGroups": []map[string]interface{}{{
+			"Name":             "runonce",
+			"Count":            1,
+			"RestartPolicy":    map[string]interface{}{"Attempts": 0, "Mode": "fail"},
+			"ReschedulePolicy": map[string]interface{}{"Attempts": 0, "Unlimited": false},
+			"Tasks": []map[string]interface{}{{
+				"Name":      nomadTask,
+				"Driver":    "docker",
+				"Config":    config,
+				"Env":       spec.envMap(),
+				"Resources": resources,
+			}},
+		}},
+	}
+}
+
+// runNomad submits the job, streams the output of its allocation and returns the task's exit code
+func (r *Runner) runNomad(ctx context.Context, spec *backendJob, stdout, stderr io.Writer) (int, error) {
+	c := newNomadClient(r.log)
+	jobID := "runonce-" + spec.RunID[:8]
+	if err := c.request(ctx, http.MethodPut, "/v1/jobs", nil, map[string]interface{}{"Job": r.nomadJob(spec, jobID)}, nil); err != nil {
+		return 0, errors.Wrap(err, "cannot submit job")
+	}
+	r.log.Printf("submitted nomad job %s\n", jobID)
+	defer func() {
+		purgeCtx, cancel := context.WithTimeout(context.Background(), r.cleanupTimeout)
+		defer cancel()
+		if err := c.request(purgeCtx, http.MethodDelete, "/v1/job/"+jobID, url.Values{"purge": {"true"}}, nil, nil); err != nil {
+			r.log.Printf("cannot purge nomad job %s: %v\n", jobID, err)
+		}
+	}()
+
+	var deadline <-chan time.Time
+	if spec.Timeout > 0 {
+		deadline = time.After(spec.Timeout)
+	}
+
+	var allocID string
+	logsStarted := false
+	logsCtx, stopLogs := context.WithCancel(ctx)
+	defer stopLogs()
+	logsDone := make(chan struct{}, 2)
+
+	for {
+		select {
+		case <-deadline:
+			return 0, errors.Wrapf(ErrTimeout, "run timeout of %s exceeded", r.formatDuration(spec.Timeout))
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(nomadPollInterval):
+		}
+
+		if allocID == "" {
+			var allocs []nomadAllocation
+			if err := c.request(ctx, http.MethodGet, "/v1/job/"+jobID+"/allocations", nil, nil, &allocs); err != nil {
+				return 0, err
+			}
+			if len(allocs) == 0 {
+				continue
+			}
+			allocID = allocs[0].ID
+			if r.verbosity >= verboseInfo {
+				r.log.Printf("nomad allocation %s\n", allocID)
+			}
+		}
+
+		var alloc nomadAllocation
+		if err := c.request(ctx, http.MethodGet, "/v1/allocation/"+allocID, nil, nil, &alloc); err != nil {
+			return 0, err
+		}
+		task := alloc.TaskStates[nomadTask]
+		if !logsStarted && task.State != "" && task.State != "pending" {
+			logsStarted = true
+			go c.streamLogs(logsCtx, allocID, "stdout", stdout, logsDone)
+			go c.streamLogs(logsCtx, allocID, "stderr", stderr, logsDone)
+		}
+
+		switch alloc.ClientStatus {
+		case "complete", "failed", "lost":
+		default:
+			continue
+		}
+		if logsStarted {
+			for i := 0; i < 2; i++ {
+				select {
+				case <-logsDone:
+				case <-time.After(drainTimeout):
+				}
+			}
+		}
+		for i := len(task.Events) - 1; i >= 0; i-- {
+			if e := task.Events[i]; e.Type == "Terminated" {
+				return e.ExitCode, nil
+			}
+		}
+		reason := alloc.ClientStatus
+		if n := len(task.Events); n > 0 {
+			reason = fmt.Sprintf("%s: %s", reason, task.Events[n-1].DisplayMessage)
+		}
+		return 0, errors.Errorf("nomad allocation ended without the task terminating (%s)", reason)
+	}
+}
+
+// streamLogs copies one output stream of the task until it is done
+func (c *nomadClient) streamLogs(ctx context.Context, allocID, stream string, w io.Writer, done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
+	query := url.Values{
+		"task":   {nomadTask},
+		"type":   {stream},
+		"follow": {"true"},
+		"origin": {"start"},
+		"offset": {"0"},
+		"plain":  {"true"},
+	}
+	resp, err := c.open(ctx, http.MethodGet, "/v1/client/fs/logs/"+allocID, query, nil)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.log.Printf("cannot stream %s: %v\n", stream, err)
+		}
+		return
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(w, resp.Body)
+}
+
+func init() {
+	rootCmd.Flags().StringSliceVar(&cliOptions.nomadDatacenters, "nomad-datacenter", []string{"dc1"}, "datacenters a --backend nomad job may run in")
+}
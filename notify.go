@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// notifyTimeout limits posting a notification
+const notifyTimeout = 10 * time.Second
+
+const defaultNotifyTemplate = `{{.Image}} failed with exit code {{.ExitCode}} on {{.Host}} after {{duration .Duration}}` +
+	`{{if .TimedOut}} (timed out){{end}}{{if .OOMKilled}} (out of memory){{end}}{{if .Error}}: {{.Error}}{{end}}`
+
+// notifyConfig is the notify section of a profile: a Slack or Mattermost incoming webhook
+// posted to when the run ends in one of the On conditions, by default any failure
+type notifyConfig struct {
+	Webhook  string   `yaml:"webhook"`
+	Channel  string   `yaml:"channel"`
+	Template string   `yaml:"template"`
+	On       []string `yaml:"on"`
+}
+
+// template parses the notification template with the functions of the run
+func (n *notifyConfig) template(funcs template.FuncMap) (*template.Template, error) {
+	text := n.Template
+	if text == "" {
+		text = defaultNotifyTemplate
+	}
+	tmpl, err := template.New("notify").Funcs(funcs).Parse(text)
+	return tmpl, errors.Wrap(err, "invalid notify template")
+}
+
+func (n *notifyConfig) validate(funcs template.FuncMap) error {
+	if n.Webhook == "" {
+		return errors.New("notify needs a webhook")
+	}
+	for _, on := range n.On {
+		switch on {
+		case "failure", "timeout", "oom":
+		default:
+			return errors.Errorf("invalid notify condition '%s', expected failure, timeout or oom", on)
+		}
+	}
+	_, err := n.template(funcs)
+	return err
+}
+
+// triggered reports whether the result meets one of the conditions
+func (n *notifyConfig) triggered(result *runResult) bool {
+	if len(n.On) == 0 {
+		return result.ExitCode != 0
+	}
+	for _, on := range n.On {
+		switch {
+		case on == "failure" && result.ExitCode != 0,
+			on == "timeout" && result.TimedOut,
+			on == "oom" && result.OOMKilled:
+			return true
+		}
+	}
+	return false
+}
+
+// notify posts the rendered template to the webhook; Slack and Mattermost take the same payload
+func (n *notifyConfig) notify(result *runResult, funcs template.FuncMap) error {
+	if !n.triggered(result) {
+		return nil
+	}
+	tmpl, err := n.template(funcs)
+	if err != nil {
+		return err
+	}
+	var text bytes.Buffer
+	if err := tmpl.Execute(&text, result); err != nil {
+		return err
+	}
+	payload := map[string]string{"text": text.String()}
+	if n.Channel != "" {
+		payload["channel"] = n.Channel
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	return apiRequest(ctx, http.DefaultClient, http.MethodPost, n.Webhook, nil, payload, nil)
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestNotifyTriggered(t *testing.T) {
+	tests := []struct {
+		name      string
+		on        []string
+		exitCode  int
+		timedOut  bool
+		oomKilled bool
+		want      bool
+	}{
+		{name: "default on success", want: false},
+		{name: "default on failure", exitCode: 1, want: true},
+		{name: "failure", on: []string{"failure"}, exitCode: 2, want: true},
+		{name: "timeout only, failed", on: []string{"timeout"}, exitCode: 1, want: false},
+		{name: "timeout", on: []string{"timeout"}, exitCode: 1, timedOut: true, want: true},
+		{name: "oom", on: []string{"timeout", "oom"}, exitCode: 137, oomKilled: true, want: true},
+		{name: "oom, succeeded", on: []string{"failure"}, oomKilled: true, want: false},
+		{name: "unknown condition", on: []string{"success"}, want: false},
+	}
+	for _, tt := range tests {
+		n := &notifyConfig{On: tt.on}
+		result := &runResult{ExitCode: tt.exitCode, TimedOut: tt.timedOut, OOMKilled: tt.oomKilled}
+		if got := n.triggered(result); got != tt.want {
+			t.Errorf("%s: triggered = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import "time"
+
+// options are the settings of a run, bound to the flags of the root command for the command line;
+// they are grouped by the file registering their flags
+type options struct {
+	timeout             string
+	bindCwd             string
+	memoryLimit         string
+	memoryFloor         string
+	stdinMode           string
+	optionLabelPrefix   string
+	imageName           string
+	verbosity           int
+	stopTimeout         int
+	concurrentExecution bool
+	forwardImageArgs    bool
+	reattachRetries     int
+	outputPrefixFormat  string
+	colorOutput         bool
+	timestamps          bool
+	heartbeat           time.Duration
+	quiet               bool
+	eventsTarget        string
+	logTarget           string
+	logFacility         string
+	onConflict          string
+	runName             string
+	keepOnError         bool
+	postExec            string
+	postExecTimeout     time.Duration
+	envVars             []string
+	volumeBinds         []string
+	containerRuntime    string
+	cgroupParent        string
+	shmSize             string
+	sysctls             []string
+	memorySwap          string
+	memoryReservation   string
+	memorySwappiness    int
+	cpus                string
+	cpuSharesPreset     string
+	blkioWeightPreset   string
+	sidecars            []string
+	networkName         string
+	ipAddress           string
+	ip6Address          string
+	macAddress          string
+	outputDigest        string
+	timeoutMax          string
+	ignoreLabels        bool
+	strictLabels        bool
+	reconnectTimeout    time.Duration
+	stopSignal          string
+	exitCodeMappings    []string
+	failOnRegex         string
+	successRegex        string
+	teeStdin            string
+	teeStdout           string
+	cpuTimeLimit        time.Duration
+
+	aciResourceGroup string
+	aciLocation      string
+
+	adoptTimeout string
+
+	loadImage  string
+	saveOutput string
+
+	requireAttestation  []string
+	attestationKey      string
+	attestationIdentity string
+	attestationIssuer   string
+
+	backendName string
+
+	benchRuns int
+
+	stdoutFile     string
+	stderrFile     string
+	compressOutput string
+	rotateSize     string
+	rotateInterval time.Duration
+
+	captureDirSpecs []string
+
+	rmMode         string
+	cleanupMode    string
+	cleanupTimeout time.Duration
+
+	cloudRunProject string
+	cloudRunRegion  string
+
+	profileName string
+	configPath  string
+
+	debugListen string
+
+	minFreeSpace string
+
+	fallbackImage string
+
+	fileArgs bool
+
+	githubActions bool
+
+	historyEnabled    bool
+	historyRetention  time.Duration
+	historyMaxEntries int
+	dedupeWindow      time.Duration
+	dedupeKey         string
+	dedupeExitCode    int
+	historyImage      string
+	historyFailed     bool
+	historyLimit      int
+	historyJSON       bool
+
+	daemonHosts []string
+
+	disambiguate string
+
+	jobFile string
+
+	junitPath string
+
+	logsFollow     bool
+	logsTail       string
+	logsTimestamps bool
+
+	mailTo   []string
+	mailOn   string
+	mailTail string
+
+	stopGracePeriod int
+	killSignal      string
+
+	nomadDatacenters []string
+
+	tieToParent bool
+
+	pickStrategy string
+
+	pingURL string
+
+	pluginsDir string
+
+	pullRetries  int
+	pullMirror   string
+	pullParallel int
+
+	ioRateLimit string
+
+	readOnlyRoot  bool
+	writablePaths []string
+
+	remoteAddr string
+	tlsCA      string
+	tlsCert    string
+	tlsKey     string
+
+	reportSince  string
+	reportUntil  string
+	reportFormat string
+
+	resultFormat     string
+	resultFormatFile string
+
+	scanImage   bool
+	scanner     string
+	maxSeverity string
+	scanMaxAge  time.Duration
+
+	scriptFromStdin bool
+	scriptFile      string
+
+	serveSocket string
+	serveGroup  string
+	serveListen string
+
+	shellWrap bool
+
+	cgroupSlice string
+	sliceScope  bool
+
+	splay time.Duration
+
+	stdinProgress time.Duration
+
+	stdinListen string
+
+	noTTY    bool
+	forceTTY bool
+
+	rawUnits bool
+
+	usernsMode string
+
+	failOnWarnings bool
+
+	isolation string
+
+	runWindow  string
+	windowWait bool
+
+	workspacePath string
+}
+
+// cliOptions holds the options as given on the command line
+var cliOptions options
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// prefixColors are the ANSI foreground colors cycled through for --color, picked per container
+var prefixColors = []string{"\x1b[32m", "\x1b[33m", "\x1b[34m", "\x1b[35m", "\x1b[36m", "\x1b[92m"}
+
+const colorReset = "\x1b[0m"
+
+// lineWriter writes the result of prefix in front of every line written to w
+type lineWriter struct {
+	w       io.Writer
+	prefix  func() string
+	mu      sync.Mutex
+	midLine bool
+	lineBuf bytes.Buffer
+}
+
+func newLineWriter(w io.Writer, prefix func() string) *lineWriter {
+	return &lineWriter{w: w, prefix: prefix}
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.lineBuf.Reset()
+	for rest := p; len(rest) > 0; {
+		if !lw.midLine {
+			lw.lineBuf.WriteString(lw.prefix())
+			lw.midLine = true
+		}
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			lw.lineBuf.Write(rest)
+			break
+		}
+		lw.lineBuf.Write(rest[:i+1])
+		rest = rest[i+1:]
+		lw.midLine = false
+	}
+
+	// write in one go so lines of concurrent invocations sharing a file don't interleave mid-line
+	if _, err := lw.w.Write(lw.lineBuf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// outputPrefix expands the --prefix template for a container, optionally colorized
+func outputPrefix(template, containerId string, color bool) string {
+	if template == "" {
+		return ""
+	}
+	shortId := containerId
+	if len(shortId) > 12 {
+		shortId = shortId[:12]
+	}
+	prefix := strings.ReplaceAll(template, "{id}", shortId)
+	if !color {
+		return prefix
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(containerId))
+	return prefixColors[h.Sum32()%uint32(len(prefixColors))] + prefix + colorReset
+}
+
+// wrapOutput applies line prefixing and timestamps to a container output stream if any is configured
+func wrapOutput(w io.Writer, prefix string, timestamps bool) io.Writer {
+	switch {
+	case timestamps:
+		return newLineWriter(w, func() string {
+			// same format as docker logs -t
+			return time.Now().UTC().Format(time.RFC3339Nano) + " " + prefix
+		})
+	case prefix != "":
+		return newLineWriter(w, func() string { return prefix })
+	default:
+		return w
+	}
+}
+
+// demuxStream splits a multiplexed (non-TTY) container stream into stdout and stderr.
+// Each frame has an 8 byte header: stream type, three padding bytes and the big-endian payload size.
+func demuxStream(r io.Reader, stdout, stderr io.Writer) error {
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var w io.Writer
+		switch header[0] {
+		case 0, 1:
+			w = stdout
+		case 2:
+			w = stderr
+		default:
+			return errors.Errorf("invalid stream type %d in multiplexed output", header[0])
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return err
+		}
+	}
+}
+
+// tailBuffer keeps the last size bytes written to it
+type tailBuffer struct {
+	mu   sync.Mutex
+	size int
+	buf  []byte
+}
+
+func newTailBuffer(size int) *tailBuffer {
+	return &tailBuffer{size: size}
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.size {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.size:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
+
+// newOutputDigest returns the hash named by --output-digest
+func newOutputDigest(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, errors.Errorf("unsupported output digest '%s', use sha256 or sha512", algorithm)
+}
+
+// matcherLineLimit bounds how much of an unterminated line is buffered for matching
+const matcherLineLimit = 64 * 1024
+
+// outputMatcher records whether any line written to it matches re
+type outputMatcher struct {
+	mu      sync.Mutex
+	re      *regexp.Regexp
+	line    []byte
+	matched bool
+}
+
+func (m *outputMatcher) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.matched {
+		return len(p), nil
+	}
+	m.line = append(m.line, p...)
+	for {
+		i := bytes.IndexByte(m.line, '\n')
+		if i < 0 {
+			break
+		}
+		if m.re.Match(m.line[:i]) {
+			m.matched, m.line = true, nil
+			return len(p), nil
+		}
+		m.line = m.line[i+1:]
+	}
+	if len(m.line) > matcherLineLimit {
+		m.matched = m.re.Match(m.line)
+		m.line = nil
+	}
+	return len(p), nil
+}
+
+// Matched reports a match, including in a final line without newline
+func (m *outputMatcher) Matched() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.matched && len(m.line) > 0 {
+		m.matched = m.re.Match(m.line)
+	}
+	return m.matched
+}
+
+// outputMatchers scans both output streams for a pattern
+type outputMatchers []*outputMatcher
+
+// watch returns w also feeding a new matcher for re; without re it is w
+func (ms *outputMatchers) watch(w io.Writer, re *regexp.Regexp) io.Writer {
+	if re == nil {
+		return w
+	}
+	m := &outputMatcher{re: re}
+	*ms = append(*ms, m)
+	return io.MultiWriter(w, m)
+}
+
+func (ms outputMatchers) Matched() bool {
+	for _, m := range ms {
+		if m.Matched() {
+			return true
+		}
+	}
+	return false
+}
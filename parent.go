@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// parentPollInterval is how often --tie-to-parent checks for the parent process
+const parentPollInterval = time.Second
+
+// watchParent calls stop once the parent process is gone, noticed by being reparented,
+// and returns then or when ctx is done; where available the kernel also signals its death right away
+func (r *Runner) watchParent(ctx context.Context, stop func()) {
+	ppid := os.Getppid()
+	setParentDeathSignal()
+	ticker := time.NewTicker(parentPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if os.Getppid() != ppid {
+				r.log.Printf("parent process %d is gone\n", ppid)
+				stop()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func init() {
+	rootCmd.Flags().BoolVar(&cliOptions.tieToParent, "tie-to-parent", false, "stop the container if the parent process of docker-runonce dies")
+}
@@ -0,0 +1,10 @@
+package main
+
+import "syscall"
+
+const prSetPdeathsig = 1
+
+// setParentDeathSignal has the kernel send SIGTERM when the parent dies, which stops the run like any SIGTERM
+func setParentDeathSignal() {
+	_, _, _ = syscall.RawSyscall(syscall.SYS_PRCTL, prSetPdeathsig, uintptr(syscall.SIGTERM), 0)
+}
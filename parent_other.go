@@ -0,0 +1,7 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// setParentDeathSignal does nothing, only Linux has a parent death signal
+func setParentDeathSignal() {}
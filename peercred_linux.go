@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// unixPeerUID returns the uid of the process on the other end of the Unix socket
+func unixPeerUID(conn *net.UnixConn) (string, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return "", err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return "", err
+	}
+	if credErr != nil {
+		return "", credErr
+	}
+	return strconv.FormatUint(uint64(cred.Uid), 10), nil
+}
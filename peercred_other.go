@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// unixPeerUID fails, only Linux reports the peer credentials of Unix sockets here
+func unixPeerUID(conn *net.UnixConn) (string, error) {
+	return "", errors.New("the clients of the Unix socket can only be identified on Linux, use --listen")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	docker_cli "docker.io/go-docker"
+	"github.com/pkg/errors"
+)
+
+// setDaemonEnv selects the daemon for clients the runner creates afterwards and returns a function restoring the previous one
+func (r *Runner) setDaemonEnv(env []string) func() {
+	saved := make(map[string]string, len(r.dockerEnv))
+	for name, v := range r.dockerEnv {
+		saved[name] = v
+	}
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		r.dockerEnv[kv[0]] = kv[1]
+	}
+	return func() {
+		r.dockerEnv = saved
+	}
+}
+
+// daemonLoad is what least-loaded picks by: the fewest running jobs, then the most memory not claimed by their limits
+type daemonLoad struct {
+	runningJobs int
+	freeMemory  int64
+}
+
+func queryDaemonLoad(ctx context.Context, docker *docker_cli.Client) (daemonLoad, error) {
+	info, err := docker.Info(ctx)
+	if err != nil {
+		return daemonLoad{}, err
+	}
+	containers, err := findManagedContainers(ctx, docker, false, nil)
+	if err != nil {
+		return daemonLoad{}, err
+	}
+	load := daemonLoad{freeMemory: info.MemTotal}
+	for _, c := range containers {
+		if c.Labels[labelRole] != "" {
+			continue
+		}
+		load.runningJobs++
+		if inspect, err := docker.ContainerInspect(ctx, c.ID); err == nil && inspect.HostConfig != nil {
+			load.freeMemory -= inspect.HostConfig.Memory
+		}
+	}
+	return load, nil
+}
+
+// pickLeastLoaded selects the daemon of --hosts with the least load for the run; unreachable ones are skipped
+func (r *Runner) pickLeastLoaded(ctx context.Context) error {
+	var best []string
+	var bestLoad daemonLoad
+	for _, host := range r.daemonHosts {
+		env, err := daemonEnv(host)
+		if err != nil {
+			return err
+		}
+		restore := r.setDaemonEnv(env)
+		docker, err := r.newDockerClient()
+		restore()
+		if err != nil {
+			return err
+		}
+		load, err := queryDaemonLoad(ctx, docker)
+		docker.Close()
+		if err != nil {
+			r.log.Printf("skipping %s: %v\n", host, err)
+			continue
+		}
+		if r.verbosity >= verboseInfo {
+			r.log.Printf("%s: %d running jobs, %s memory free\n", host, load.runningJobs, r.formatBytes(uint64(maxInt64(load.freeMemory, 0))))
+		}
+		if best == nil || load.runningJobs < bestLoad.runningJobs ||
+			(load.runningJobs == bestLoad.runningJobs && load.freeMemory > bestLoad.freeMemory) {
+			best, bestLoad, r.pickedHost = env, load, host
+		}
+	}
+	if best == nil {
+		return errors.New("none of the --hosts daemons is reachable")
+	}
+	r.log.Printf("running on %s\n", r.pickedHost)
+	r.setDaemonEnv(best)
+	return nil
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.pickStrategy, "pick", "", "with --hosts, run on one daemon instead of all: least-loaded picks the one with the fewest running jobs and most free memory")
+}
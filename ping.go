@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pingTimeout limits each attempt of a ping; failed pings are retried pingAttempts times in all
+const (
+	pingTimeout  = 10 * time.Second
+	pingAttempts = 3
+)
+
+// ping posts to the --ping-url endpoint with the suffix; a failed ping is logged but never fails the run
+func (r *Runner) ping(suffix, body string) {
+	url := strings.TrimSuffix(r.pingURL, "/") + suffix
+	var err error
+	for attempt := 1; attempt <= pingAttempts; attempt++ {
+		if err = pingOnce(url, body); err == nil {
+			return
+		}
+		if attempt < pingAttempts {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+	r.log.Printf("cannot ping %s: %v\n", url, err)
+}
+
+func pingOnce(url, body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("ping failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// pingStart signals the start of the run
+func (r *Runner) pingStart() {
+	r.ping("/start", "")
+}
+
+// pingDone signals the end of the run with its exit code, which the service counts as success if 0;
+// the error, if any, is sent along to show up in the ping's log
+func (r *Runner) pingDone(code int, err error) {
+	body := ""
+	if err != nil {
+		body = err.Error()
+	}
+	r.ping("/"+strconv.Itoa(code), body)
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.pingURL, "ping-url", "", "healthchecks.io style URL pinged with /start at launch and /<exit code> when done")
+}
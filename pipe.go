@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var pipeCmd = &cobra.Command{
+	Use:   "pipe [--flag=value...] image [args...] -- [--flag=value...] image [args...] ...",
+	Short: "run images concurrently with the stdout of each connected to the stdin of the next",
+	Long: `pipe runs several images once each, like a shell pipeline. All containers are started
+concurrently. Options for a stage go before its image and must use the --flag=value form.
+The exit status is that of the last stage that failed, as with pipefail.`,
+	DisableFlagParsing: true,
+	RunE:               runPipe,
+}
+
+// pipeStages splits the arguments at each -- into the argument lists of the stages
+func pipeStages(args []string) ([][]string, error) {
+	var stages [][]string
+	stage := []string{}
+	for _, arg := range append(args, "--") {
+		if arg != "--" {
+			stage = append(stage, arg)
+			continue
+		}
+		var flags []string
+		for len(stage) > 0 && strings.HasPrefix(stage[0], "-") {
+			flags, stage = append(flags, stage[0]), stage[1:]
+		}
+		if len(stage) == 0 {
+			return nil, errors.New("pipe stage without an image")
+		}
+		stages = append(stages, append(append(flags, "--image", stage[0], "--"), stage[1:]...))
+		stage = []string{}
+	}
+	if len(stages) < 2 {
+		return nil, errors.New("pipe needs at least two stages separated by --")
+	}
+	return stages, nil
+}
+
+func runPipe(cmd *cobra.Command, args []string) error {
+	stages, err := pipeStages(args)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmds := make([]*exec.Cmd, len(stages))
+	var pipeEnds []*os.File
+	defer func() {
+		for _, f := range pipeEnds {
+			f.Close()
+		}
+	}()
+	for i, stageArgs := range stages {
+		c := exec.Command(exe, stageArgs...)
+		c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if i > 0 {
+			r, w, err := os.Pipe()
+			if err != nil {
+				return err
+			}
+			pipeEnds = append(pipeEnds, r, w)
+			cmds[i-1].Stdout, c.Stdin = w, r
+		}
+		cmds[i] = c
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	for i, c := range cmds {
+		if err := c.Start(); err != nil {
+			for _, started := range cmds[:i] {
+				started.Process.Kill()
+			}
+			return errors.Wrapf(err, "cannot start pipe stage %d", i+1)
+		}
+	}
+	// only the stages may hold the pipes, or a stage exiting early would not stop its writer
+	for _, f := range pipeEnds {
+		f.Close()
+	}
+	pipeEnds = nil
+
+	// a terminal's SIGINT already reaches every stage through the process group
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				if sig != syscall.SIGTERM {
+					continue
+				}
+				for _, c := range cmds {
+					c.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	exitCode := 0
+	for _, c := range cmds {
+		c.Wait()
+		if code := c.ProcessState.ExitCode(); code != 0 {
+			exitCode = code
+		}
+	}
+	if exitCode != 0 {
+		return &exitCodeError{code: exitCode}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(pipeCmd)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"docker.io/go-docker/api/types/container"
+	"github.com/pkg/errors"
+)
+
+// hookContext is passed as JSON on stdin to plugin executables
+type hookContext struct {
+	Hook        string                `json:"hook"`
+	RunID       string                `json:"runId"`
+	Image       string                `json:"image"`
+	Args        []string              `json:"args"`
+	ContainerID string                `json:"containerId,omitempty"`
+	Config      *container.Config     `json:"config"`
+	HostConfig  *container.HostConfig `json:"hostConfig"`
+}
+
+// specUpdate is what a pre-create plugin may print to replace the container spec
+type specUpdate struct {
+	Config     *container.Config     `json:"config"`
+	HostConfig *container.HostConfig `json:"hostConfig"`
+}
+
+func defaultPluginsDir() string {
+	return filepath.Join(filepath.Dir(defaultConfigPath()), "plugins")
+}
+
+// runHook runs the job file's or plugin executable for the hook, if there is one.
+// A failing plugin or, for pre-create, invalid spec output is an error.
+func (r *Runner) runHook(hook string, hc *hookContext) error {
+	path := r.jobHooks[hook]
+	if path == "" {
+		if r.pluginsDir == "" {
+			return nil
+		}
+		path = filepath.Join(r.pluginsDir, hook)
+		if info, err := os.Stat(path); err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+			return nil
+		}
+	}
+
+	hc.Hook = hook
+	input, err := json.Marshal(hc)
+	if err != nil {
+		return err
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "%s plugin failed", hook)
+	}
+	if r.verbosity >= verboseInfo {
+		r.log.Printf("ran %s plugin\n", hook)
+	}
+
+	if hook != "pre-create" || len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil
+	}
+	var update specUpdate
+	if err := json.Unmarshal(stdout.Bytes(), &update); err != nil {
+		return errors.Wrapf(err, "invalid output of %s plugin", hook)
+	}
+	if update.Config != nil {
+		hc.Config = update.Config
+	}
+	if update.HostConfig != nil {
+		hc.HostConfig = update.HostConfig
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.pluginsDir, "plugins-dir", defaultPluginsDir(), "directory of hook executables (pre-create, post-start, pre-remove)")
+}
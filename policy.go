@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	docker_cli "docker.io/go-docker"
+	"docker.io/go-docker/api/types/container"
+	"docker.io/go-docker/api/types/network"
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// policyPath is managed by the host administrator and deliberately not configurable by users
+const policyPath = "/etc/docker-runonce/policy.yaml"
+
+// runPolicy restricts what may be run on a shared host
+type runPolicy struct {
+	Images struct {
+		// patterns match the normalized reference (docker.io/library/alpine:latest) or the digest;
+		// * matches any sequence of characters
+		Allow []string `yaml:"allow"`
+		Deny  []string `yaml:"deny"`
+	} `yaml:"images"`
+	Mounts struct {
+		// host paths that may not be bind-mounted, including everything below them
+		Forbidden []string `yaml:"forbidden"`
+	} `yaml:"mounts"`
+	Limits struct {
+		Memory string  `yaml:"memory"`
+		CPUs   float64 `yaml:"cpus"`
+	} `yaml:"limits"`
+}
+
+// loadPolicy reads the policy file; without one everything is allowed
+func loadPolicy() (*runPolicy, error) {
+	data, err := ioutil.ReadFile(policyPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var p runPolicy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, errors.Wrapf(err, "invalid policy file '%s'", policyPath)
+	}
+	return &p, nil
+}
+
+// normalizeReference expands short image names the way the daemon does
+func normalizeReference(image string) string {
+	if i := strings.Index(image, "/"); i < 0 {
+		image = "docker.io/library/" + image
+	} else if first := image[:i]; !strings.ContainsAny(first, ".:") && first != "localhost" {
+		image = "docker.io/" + image
+	}
+	return image
+}
+
+func globMatch(pattern, s string) bool {
+	re := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+	matched, _ := regexp.MatchString(re, s)
+	return matched
+}
+
+func matchesAny(patterns []string, values ...string) bool {
+	for _, p := range patterns {
+		for _, v := range values {
+			if v != "" && globMatch(p, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolvePath follows the symlinks of the longest existing part of path, so that a link below an
+// allowed directory cannot point into a forbidden one
+func resolvePath(path string) string {
+	path = filepath.Clean(path)
+	for rest := ""; ; {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest)
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+func isBelow(path, dir string) bool {
+	path, dir = resolvePath(path), resolvePath(dir)
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// check evaluates the container spec against the policy
+func (p *runPolicy) check(image, digest string, hostConfig *container.HostConfig) error {
+	if p == nil {
+		return nil
+	}
+
+	ref := normalizeReference(image)
+	if matchesAny(p.Images.Deny, ref, digest) {
+		return errors.Wrapf(ErrPolicyDenied, "image '%s' is denied", image)
+	}
+	if len(p.Images.Allow) > 0 && !matchesAny(p.Images.Allow, ref, digest) {
+		return errors.Wrapf(ErrPolicyDenied, "image '%s' is not allowed", image)
+	}
+
+	var sources []string
+	for _, bind := range hostConfig.Binds {
+		sources = append(sources, bindSource(bind))
+	}
+	for _, m := range hostConfig.Mounts {
+		if m.Type == "bind" {
+			sources = append(sources, m.Source)
+		} else if m.VolumeOptions != nil && m.VolumeOptions.DriverConfig != nil {
+			if _, ok := bindDevice(m.VolumeOptions.DriverConfig.Options); ok {
+				return errors.Wrapf(ErrPolicyDenied, "volume '%s' has bind options", m.Source)
+			}
+		}
+	}
+	for _, source := range sources {
+		for _, forbidden := range p.Mounts.Forbidden {
+			if isBelow(source, forbidden) {
+				return errors.Wrapf(ErrPolicyDenied, "mounting '%s' is forbidden", source)
+			}
+		}
+	}
+
+	if hostConfig.Privileged {
+		return errors.Wrap(ErrPolicyDenied, "privileged containers are forbidden")
+	}
+	if len(hostConfig.Devices) > 0 {
+		return errors.Wrap(ErrPolicyDenied, "host devices are forbidden")
+	}
+	if len(hostConfig.CapAdd) > 0 {
+		return errors.Wrap(ErrPolicyDenied, "added capabilities are forbidden")
+	}
+
+	if p.Limits.Memory != "" {
+		maxMemory, err := humanize.ParseBytes(p.Limits.Memory)
+		if err != nil {
+			return errors.Wrapf(err, "invalid memory limit '%s' in policy", p.Limits.Memory)
+		}
+		if hostConfig.Memory <= 0 || uint64(hostConfig.Memory) > maxMemory {
+			return errors.Wrapf(ErrPolicyDenied, "memory limit exceeds the maximum of %s", p.Limits.Memory)
+		}
+	}
+	if p.Limits.CPUs > 0 {
+		if hostConfig.NanoCPUs <= 0 || float64(hostConfig.NanoCPUs)/1e9 > p.Limits.CPUs {
+			return errors.Wrapf(ErrPolicyDenied, "cpu limit exceeds the maximum of %g", p.Limits.CPUs)
+		}
+	}
+	return nil
+}
+
+// bindDevice returns the host path that local volume driver options bind, if they do
+func bindDevice(options map[string]string) (string, bool) {
+	for _, o := range strings.Split(options["o"], ",") {
+		if o == "bind" || o == "rbind" {
+			return options["device"], true
+		}
+	}
+	return "", false
+}
+
+// checkVolume evaluates the options of an existing named volume; one binding a host path is checked like a bind mount
+func (p *runPolicy) checkVolume(name string, options map[string]string) error {
+	device, ok := bindDevice(options)
+	if p == nil || !ok {
+		return nil
+	}
+	for _, forbidden := range p.Mounts.Forbidden {
+		if isBelow(device, forbidden) {
+			return errors.Wrapf(ErrPolicyDenied, "volume '%s' binds '%s', which is forbidden", name, device)
+		}
+	}
+	return nil
+}
+
+// volumeNames returns the named volumes of the spec
+func volumeNames(hostConfig *container.HostConfig) []string {
+	var names []string
+	for _, bind := range hostConfig.Binds {
+		// host paths are absolute, with a drive letter on Windows
+		if source := bindSource(bind); !strings.HasPrefix(source, "/") && !(len(source) >= 2 && source[1] == ':') {
+			names = append(names, source)
+		}
+	}
+	for _, m := range hostConfig.Mounts {
+		if m.Type == "volume" && m.Source != "" {
+			names = append(names, m.Source)
+		}
+	}
+	return names
+}
+
+// createContainer creates a container once the policy allows it; every container of a run is created here,
+// after any plugin has changed the spec. image is checked against the image lists, for snapshots the image they were taken of.
+// Failures of the daemon are infrastructureErrors.
+func (r *Runner) createContainer(ctx context.Context, docker *docker_cli.Client, image string, config *container.Config,
+	hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig) (container.ContainerCreateCreatedBody, error) {
+
+	policy, err := loadPolicy()
+	if err != nil {
+		return container.ContainerCreateCreatedBody{}, err
+	}
+	if policy != nil {
+		digest := ""
+		if inspect, _, ierr := docker.ImageInspectWithRaw(ctx, image); ierr == nil {
+			digest = inspect.ID
+			if len(inspect.RepoDigests) > 0 {
+				digest = inspect.RepoDigests[0]
+			}
+		}
+		if err := policy.check(image, digest, hostConfig); err != nil {
+			return container.ContainerCreateCreatedBody{}, err
+		}
+		for _, name := range volumeNames(hostConfig) {
+			// a volume that does not exist yet is created by the daemon without options
+			if vol, verr := docker.VolumeInspect(ctx, name); verr == nil {
+				if err := policy.checkVolume(name, vol.Options); err != nil {
+					return container.ContainerCreateCreatedBody{}, err
+				}
+			}
+		}
+	}
+	resp, err := docker.ContainerCreate(ctx, config, hostConfig, networkingConfig, "")
+	if err != nil {
+		return resp, infrastructureError{err}
+	}
+	return resp, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"docker.io/go-docker/api/types/container"
+	"docker.io/go-docker/api/types/mount"
+	"github.com/pkg/errors"
+)
+
+func TestIsBelow(t *testing.T) {
+	root := t.TempDir()
+	allowed := filepath.Join(root, "data")
+	outside := filepath.Join(root, "secret")
+	for _, dir := range []string{allowed, outside} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := true
+	if err := os.Symlink(outside, filepath.Join(allowed, "link")); err != nil {
+		links = false
+	}
+
+	tests := []struct {
+		path, dir string
+		want      bool
+		link      bool
+	}{
+		{path: allowed, dir: allowed, want: true},
+		{path: filepath.Join(allowed, "file"), dir: allowed, want: true},
+		{path: filepath.Join(allowed, "new", "file"), dir: allowed, want: true},
+		{path: filepath.Join(allowed, "..", "secret"), dir: allowed, want: false},
+		{path: allowed + "2", dir: allowed, want: false},
+		{path: root, dir: allowed, want: false},
+		{path: filepath.Join(allowed, "x"), dir: allowed + string(filepath.Separator), want: true},
+		{path: filepath.Join(allowed, "link"), dir: allowed, want: false, link: true},
+		{path: filepath.Join(allowed, "link", "key"), dir: allowed, want: false, link: true},
+		{path: filepath.Join(allowed, "link", "key"), dir: outside, want: true, link: true},
+	}
+	for _, tt := range tests {
+		if tt.link && !links {
+			continue
+		}
+		if got := isBelow(tt.path, tt.dir); got != tt.want {
+			t.Errorf("isBelow(%q, %q) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyCheckHostConfig(t *testing.T) {
+	p := &runPolicy{}
+	p.Mounts.Forbidden = []string{"/etc"}
+	bindVolume := mount.Mount{Type: "volume", Source: "v", VolumeOptions: &mount.VolumeOptions{
+		DriverConfig: &mount.Driver{Name: "local", Options: map[string]string{"type": "none", "o": "ro,bind", "device": "/"}},
+	}}
+	nfsVolume := mount.Mount{Type: "volume", Source: "v", VolumeOptions: &mount.VolumeOptions{
+		DriverConfig: &mount.Driver{Name: "local", Options: map[string]string{"type": "nfs", "o": "addr=10.0.0.1", "device": ":/export"}},
+	}}
+
+	tests := []struct {
+		name       string
+		hostConfig container.HostConfig
+		denied     bool
+	}{
+		{name: "plain", hostConfig: container.HostConfig{Binds: []string{"/data:/data"}}},
+		{name: "forbidden bind", hostConfig: container.HostConfig{Binds: []string{"/etc/ssl:/ssl:ro"}}, denied: true},
+		{name: "privileged", hostConfig: container.HostConfig{Privileged: true}, denied: true},
+		{name: "devices", hostConfig: container.HostConfig{Resources: container.Resources{
+			Devices: []container.DeviceMapping{{PathOnHost: "/dev/sda", PathInContainer: "/dev/sda"}},
+		}}, denied: true},
+		{name: "capabilities", hostConfig: container.HostConfig{CapAdd: []string{"SYS_ADMIN"}}, denied: true},
+		{name: "bind volume options", hostConfig: container.HostConfig{Mounts: []mount.Mount{bindVolume}}, denied: true},
+		{name: "nfs volume options", hostConfig: container.HostConfig{Mounts: []mount.Mount{nfsVolume}}},
+	}
+	for _, tt := range tests {
+		err := p.check("alpine", "", &tt.hostConfig)
+		if denied := errors.Is(err, ErrPolicyDenied); denied != tt.denied {
+			t.Errorf("%s: check() = %v, want denied %v", tt.name, err, tt.denied)
+		}
+	}
+}
+
+func TestPolicyCheckVolume(t *testing.T) {
+	p := &runPolicy{}
+	p.Mounts.Forbidden = []string{"/etc"}
+	if err := p.checkVolume("v", map[string]string{"o": "bind", "device": "/etc"}); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("volume binding /etc: got %v", err)
+	}
+	if err := p.checkVolume("v", map[string]string{"o": "bind", "device": "/data"}); err != nil {
+		t.Errorf("volume binding /data: got %v", err)
+	}
+	if err := p.checkVolume("v", nil); err != nil {
+		t.Errorf("volume without options: got %v", err)
+	}
+}
+
+func TestVolumeNames(t *testing.T) {
+	names := volumeNames(&container.HostConfig{
+		Binds:  []string{"/data:/data", "cache:/cache", `C:\data:C:\data`, "/anonymous"},
+		Mounts: []mount.Mount{{Type: "volume", Source: "work"}, {Type: "bind", Source: "/src"}, {Type: "tmpfs"}},
+	})
+	if len(names) != 2 || names[0] != "cache" || names[1] != "work" {
+		t.Errorf("volumeNames() = %q", names)
+	}
+}
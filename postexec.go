@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"io"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/container"
+	"docker.io/go-docker/api/types/network"
+	"github.com/pkg/errors"
+)
+
+// runPostExec runs the --post-exec command after the main command has exited.
+// The daemon refuses exec in a stopped container, so the container is committed and the command
+// runs in a container of that snapshot, sharing the original's volumes, network and resource limits;
+// it is the policy-checked job, so there is nothing left to check.
+func (r *Runner) runPostExec(docker *docker_cli.Client, containerId string, networkMode container.NetworkMode,
+	resources container.Resources, stdout, stderr io.Writer) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.postExecTimeout)
+	defer cancel()
+
+	commit, err := docker.ContainerCommit(ctx, containerId, docker_t.ContainerCommitOptions{
+		Comment: "docker-runonce post-exec snapshot",
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot snapshot container")
+	}
+	defer func() {
+		_, _ = docker.ImageRemove(context.Background(), commit.ID, docker_t.ImageRemoveOptions{Force: true})
+	}()
+
+	// the snapshot is checked as the image of the job
+	resp, err := r.createContainer(ctx, docker, r.imageName, &container.Config{
+		AttachStdout: true,
+		AttachStderr: true,
+		Entrypoint:   []string{"/bin/sh", "-c"},
+		Cmd:          []string{r.postExec},
+		Image:        commit.ID,
+		Labels: map[string]string{
+			labelManaged: "true",
+			labelRole:    "post-exec",
+		},
+	}, &container.HostConfig{
+		NetworkMode:   networkMode,
+		VolumesFrom:   []string{containerId},
+		RestartPolicy: container.RestartPolicy{Name: "no"},
+		Resources:     resources,
+	}, &network.NetworkingConfig{})
+	if err != nil {
+		return err
+	}
+	defer r.cleanupContainer(docker, resp.ID)
+
+	waitCh, waitErrCh := docker.ContainerWait(ctx, resp.ID, container.WaitConditionNextExit)
+	att, err := r.attachContainer(ctx, docker, resp.ID, false, stdout, stderr)
+	if err != nil {
+		return err
+	}
+	defer att.Close()
+
+	if err := docker.ContainerStart(ctx, resp.ID, docker_t.ContainerStartOptions{}); err != nil {
+		return err
+	}
+
+	select {
+	case result := <-waitCh:
+		select {
+		case <-att.closedCh:
+		case <-time.After(drainTimeout):
+		}
+		if result.StatusCode != 0 {
+			return errors.Errorf("exited with status %d", result.StatusCode)
+		}
+		return nil
+	case err := <-waitErrCh:
+		return err
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"github.com/mkke/go-docker/responses"
+	"github.com/mkke/go-mlog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var pullCmd = &cobra.Command{
+	Use:   "pull <image[@digest]>...",
+	Short: "pull job images without running them",
+	Long: `pull fetches images ahead of scheduled runs. Images pinned with @digest are verified to
+resolve to that digest; a summary table is printed at the end.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runnerCommand((*Runner).preloadImages),
+}
+
+// pullBackoff bounds the wait between rate-limited pull attempts
+const (
+	pullBackoffBase = 2 * time.Second
+	pullBackoffMax  = 2 * time.Minute
+)
+
+// tooManyRequests matches an HTTP 429 status in an error message; a bare 429 may be part of a digest, id or size
+var tooManyRequests = regexp.MustCompile(`\b429 too many requests\b`)
+
+// isRateLimited reports whether the registry throttled the pull, by the registry error code or the HTTP status
+func isRateLimited(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "toomanyrequests") || tooManyRequests.MatchString(msg)
+}
+
+// pullImage pulls images from a registry; images without a registry or user part are expected locally.
+// Registry rules of the config file redirect the pull; otherwise rate-limited pulls are retried with backoff
+// and, for Docker Hub images, finally tried from --pull-mirror.
+func (r *Runner) pullImage(ctx context.Context, docker *docker_cli.Client, image string) error {
+	if !strings.Contains(image, "/") {
+		return nil
+	}
+	cfg, err := r.loadConfig()
+	if err != nil {
+		return err
+	}
+	if target, ok := rewriteReference(cfg.Registries, image); ok {
+		if r.verbosity >= verboseInfo {
+			r.log.Printf("pulling %s as %s\n", image, target)
+		}
+		if err := r.pullWithRetry(ctx, docker, target); err != nil {
+			return err
+		}
+		// the run refers to the image by its upstream name
+		return docker.ImageTag(ctx, target, image)
+	}
+
+	err = r.pullWithRetry(ctx, docker, image)
+	if err == nil || r.pullMirror == "" || !isRateLimited(err) {
+		return err
+	}
+	ref := normalizeReference(image)
+	if !strings.HasPrefix(ref, "docker.io/") {
+		return err
+	}
+
+	mirrored := strings.TrimSuffix(r.pullMirror, "/") + strings.TrimPrefix(ref, "docker.io")
+	r.log.Printf("pull of %s rate limited, trying mirror %s\n", image, mirrored)
+	if merr := r.pullWithRetry(ctx, docker, mirrored); merr != nil {
+		return errors.Wrapf(err, "mirror pull failed (%v)", merr)
+	}
+	return docker.ImageTag(ctx, mirrored, image)
+}
+
+func (r *Runner) pullWithRetry(ctx context.Context, docker *docker_cli.Client, image string) error {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	backoff := pullBackoffBase
+	for attempt := 0; ; attempt++ {
+		err := r.pullOnce(ctx, docker, image)
+		if err == nil || !isRateLimited(err) || attempt >= r.pullRetries {
+			return err
+		}
+		// jitter keeps many throttled hosts from retrying in lockstep
+		wait := backoff/2 + time.Duration(rnd.Int63n(int64(backoff/2)+1))
+		r.log.Printf("pull of %s rate limited, retrying in %s\n", image, r.formatDuration(wait))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > pullBackoffMax {
+			backoff = pullBackoffMax
+		}
+	}
+}
+
+// closeOnCancel closes c when ctx is cancelled, aborting a transfer that is read without the context;
+// the returned function ends the watch
+func closeOnCancel(ctx context.Context, c io.Closer) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (r *Runner) pullOnce(ctx context.Context, docker *docker_cli.Client, image string) error {
+	dlog := mlog.WithPrefix("Docker", r.log)
+	if r.verbosity >= verboseInfo {
+		dlog.Printf("pulling %s", image)
+	}
+	r.runEvents.emit(runEvent{Event: "pulling", Image: image})
+	resp, err := docker.ImagePull(ctx, image, docker_t.ImagePullOptions{Platform: r.pullPlatform})
+	if err != nil {
+		return classifyPullError(err)
+	}
+	defer closeOnCancel(ctx, resp)()
+	if err = responses.ParseStreamBody(resp, dlog); err != nil {
+		if ctx.Err() != nil {
+			return errors.Wrapf(ctx.Err(), "pull of %s aborted", image)
+		}
+		return classifyPullError(err)
+	}
+	r.runEvents.emit(runEvent{Event: "pulled", Image: image})
+	return nil
+}
+
+type preloadResult struct {
+	image    string
+	digest   string
+	duration time.Duration
+	err      error
+}
+
+// preloadImage pulls one image and verifies a pinned digest
+func (r *Runner) preloadImage(ctx context.Context, docker *docker_cli.Client, image string) preloadResult {
+	start := time.Now()
+	ref := normalizeReference(image)
+	if !strings.Contains(ref, "@") && strings.LastIndex(ref, ":") < strings.LastIndex(ref, "/") {
+		ref += ":latest"
+	}
+	res := preloadResult{image: image}
+	if res.err = r.pullImage(ctx, docker, ref); res.err == nil {
+		var inspect docker_t.ImageInspect
+		if inspect, _, res.err = docker.ImageInspectWithRaw(ctx, ref); res.err == nil {
+			res.digest = inspect.ID
+			if len(inspect.RepoDigests) > 0 {
+				res.digest = inspect.RepoDigests[0]
+			}
+			if i := strings.Index(ref, "@"); i >= 0 && !containsDigest(inspect.RepoDigests, ref[i+1:]) {
+				res.err = errors.Errorf("image does not match pinned digest %s", ref[i+1:])
+			}
+		}
+	}
+	res.duration = time.Since(start)
+	return res
+}
+
+func containsDigest(repoDigests []string, digest string) bool {
+	for _, rd := range repoDigests {
+		if strings.HasSuffix(rd, "@"+digest) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runner) preloadImages(cmd *cobra.Command, images []string) error {
+	docker, err := r.newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer docker.Close()
+
+	if r.pullParallel < 1 {
+		r.pullParallel = 1
+	}
+	ctx := context.Background()
+	results := make([]preloadResult, len(images))
+	sem := make(chan struct{}, r.pullParallel)
+	var wg sync.WaitGroup
+	for i, image := range images {
+		wg.Add(1)
+		go func(i int, image string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = r.preloadImage(ctx, docker, image)
+		}(i, image)
+	}
+	wg.Wait()
+
+	failed := 0
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "IMAGE\tDIGEST\tDURATION\tSTATUS")
+	for _, res := range results {
+		status := "ok"
+		if res.err != nil {
+			status = res.err.Error()
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.image, res.digest, r.formatDuration(res.duration), status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d images failed", failed, len(images))
+	}
+	return nil
+}
+
+func init() {
+	pullCmd.Flags().IntVar(&cliOptions.pullParallel, "parallel", 4, "pull this many images at once")
+	rootCmd.AddCommand(pullCmd)
+	// runs and the pull command pull alike
+	rootCmd.PersistentFlags().IntVar(&cliOptions.pullRetries, "pull-retries", 5, "retry a rate-limited image pull this many times")
+	rootCmd.PersistentFlags().StringVar(&cliOptions.pullMirror, "pull-mirror", "", "registry to pull Docker Hub images from when rate limited, e.g. mirror.internal")
+}
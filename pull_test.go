@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestIsRateLimited(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{msg: "Error response from daemon: toomanyrequests: You have reached your pull rate limit.", want: true},
+		{msg: "unexpected status code 429 Too Many Requests", want: true},
+		{msg: "received unexpected HTTP status: 429 Too Many Requests", want: true},
+		{msg: "manifest for alpine@sha256:4290ab12 not found"},
+		{msg: "dial tcp 10.0.0.1:4290: connect: connection refused"},
+		{msg: "failed to register layer: 14290 bytes short"},
+		{msg: "unauthorized: authentication required"},
+	}
+	for _, tt := range tests {
+		if got := isRateLimited(errors.New(tt.msg)); got != tt.want {
+			t.Errorf("isRateLimited(%q) = %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
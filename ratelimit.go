@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+// rateLimiter is a token bucket of bytes, holding up to one second's worth
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSecond uint64) *rateLimiter {
+	return &rateLimiter{rate: float64(bytesPerSecond), tokens: float64(bytesPerSecond), last: time.Now()}
+}
+
+// parseRate parses a rate like 10MB/s or 512KiB/s; the /s is optional
+func parseRate(s string) (uint64, error) {
+	rate, err := humanize.ParseBytes(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err == nil && rate == 0 {
+		err = errors.New("rate must be positive")
+	}
+	return rate, err
+}
+
+// wait blocks until n bytes may pass; more than the bucket holds are let through in one-second chunks
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens < 0 {
+		// held under the lock, so writers sharing the limiter wait in turn
+		delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+		time.Sleep(delay)
+		l.last = l.last.Add(delay)
+		l.tokens = 0
+	}
+}
+
+// limitedWriter writes to w at the rate of the limiter
+type limitedWriter struct {
+	w       io.Writer
+	limiter *rateLimiter
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	chunk := int(lw.limiter.rate)
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > chunk {
+			n = chunk
+		}
+		lw.limiter.wait(n)
+		m, err := lw.w.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// limitedReader reads from r at the rate of the limiter
+type limitedReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if chunk := int(lr.limiter.rate); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		lr.limiter.wait(n)
+	}
+	return n, err
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.ioRateLimit, "io-rate-limit", "", "limit the container's stdin, and its stdout and stderr together, to this rate each, e.g. 10MB/s")
+}
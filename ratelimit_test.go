@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint64
+		wantErr bool
+	}{
+		{in: "10MB/s", want: 10000000},
+		{in: "512KiB/s", want: 512 * 1024},
+		{in: "1MiB", want: 1024 * 1024},
+		{in: " 2KB/s ", want: 2000},
+		{in: "0", wantErr: true},
+		{in: "0MB/s", wantErr: true},
+		{in: "fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRate(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRate(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseRate(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
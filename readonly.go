@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	docker_cli "docker.io/go-docker"
+	"docker.io/go-docker/api/types/mount"
+)
+
+// readOnlyScratchPaths are written to by most programs, so they are writable even without a VOLUME
+var readOnlyScratchPaths = []string{"/tmp"}
+
+// covered reports whether target is below one of the mounted paths
+func covered(target string, mounted []string) bool {
+	for _, m := range mounted {
+		if target == m || strings.HasPrefix(target, strings.TrimSuffix(m, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// readOnlyTmpfs returns tmpfs mounts for the image's VOLUME declarations, the scratch paths and
+// --writable, so images run with a read-only root; paths already mounted from the host are left alone
+func (r *Runner) readOnlyTmpfs(ctx context.Context, docker *docker_cli.Client, image string, binds []string, mounts []mount.Mount) (map[string]string, error) {
+	inspect, _, err := docker.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+
+	var mounted []string
+	for _, b := range binds {
+		if parts := strings.Split(b, ":"); len(parts) >= 2 {
+			mounted = append(mounted, path.Clean(parts[1]))
+		}
+	}
+	for _, m := range mounts {
+		mounted = append(mounted, path.Clean(m.Target))
+	}
+
+	paths := append([]string(nil), readOnlyScratchPaths...)
+	paths = append(paths, r.writablePaths...)
+	if inspect.Config != nil {
+		for volume := range inspect.Config.Volumes {
+			paths = append(paths, volume)
+		}
+	}
+	sort.Strings(paths)
+
+	tmpfs := make(map[string]string)
+	for _, p := range paths {
+		p = path.Clean(p)
+		if _, ok := tmpfs[p]; ok || covered(p, mounted) {
+			continue
+		}
+		tmpfs[p] = ""
+	}
+	return tmpfs, nil
+}
+
+func init() {
+	rootCmd.Flags().BoolVar(&cliOptions.readOnlyRoot, "read-only", false, "mount the container's root filesystem read-only, with tmpfs on /tmp and the image's volumes")
+	rootCmd.Flags().StringArrayVar(&cliOptions.writablePaths, "writable", nil, "with --read-only, also mount a tmpfs on this container path (repeatable)")
+}
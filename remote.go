@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"os"
+	"os/signal"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/docker/go-connections/tlsconfig"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// remoteFlags are consumed by the client and not forwarded to the broker
+var remoteFlags = []string{"remote", "tls-ca", "tls-cert", "tls-key"}
+
+// brokerListen opens the broker's listener; TCP requires mutual TLS
+func (r *Runner) brokerListen() (net.Listener, error) {
+	if r.serveListen == "" {
+		if err := os.Remove(r.serveSocket); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		l, err := net.Listen("unix", r.serveSocket)
+		if err != nil {
+			return nil, err
+		}
+		// clients are limited by the policy file, and who may be a client by the socket's group
+		if r.serveGroup != "" {
+			group, err := user.LookupGroup(r.serveGroup)
+			if err != nil {
+				l.Close()
+				return nil, err
+			}
+			gid, err := strconv.Atoi(group.Gid)
+			if err == nil {
+				err = os.Chown(r.serveSocket, -1, gid)
+			}
+			if err != nil {
+				l.Close()
+				return nil, errors.Wrapf(err, "cannot hand the socket to group '%s'", r.serveGroup)
+			}
+		}
+		if err := os.Chmod(r.serveSocket, 0660); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+
+	if r.tlsCA == "" || r.tlsCert == "" || r.tlsKey == "" {
+		return nil, errors.New("--listen requires --tls-ca, --tls-cert and --tls-key")
+	}
+	tlsConfig, err := tlsconfig.Server(tlsconfig.Options{
+		CAFile:     r.tlsCA,
+		CertFile:   r.tlsCert,
+		KeyFile:    r.tlsKey,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tls.Listen("tcp", r.serveListen, tlsConfig)
+}
+
+// dialBroker connects to unix:/path without TLS, and to host:port with the client certificate
+func (r *Runner) dialBroker() (net.Conn, error) {
+	if strings.HasPrefix(r.remoteAddr, "unix:") {
+		return net.Dial("unix", strings.TrimPrefix(strings.TrimPrefix(r.remoteAddr, "unix:"), "//"))
+	}
+	tlsConfig, err := tlsconfig.Client(tlsconfig.Options{
+		CAFile:   r.tlsCA,
+		CertFile: r.tlsCert,
+		KeyFile:  r.tlsKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tls.Dial("tcp", r.remoteAddr, tlsConfig)
+}
+
+// remoteArgs are the options of the run without the client-side flags, and the container args
+func (r *Runner) remoteArgs(args []string) []string {
+	return r.childArgs(remoteFlags, args)
+}
+
+func (r *Runner) sendBrokerRequest(req brokerRequest) (net.Conn, *json.Decoder, error) {
+	conn, err := r.dialBroker()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot connect to broker")
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, json.NewDecoder(bufio.NewReader(conn)), nil
+}
+
+// sendStdin forwards stdin to the broker in stdin messages, ending with one without data
+func sendStdin(conn net.Conn) {
+	enc := json.NewEncoder(conn)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			if enc.Encode(brokerRequest{Op: "stdin", Data: buf[:n]}) != nil {
+				return
+			}
+		}
+		if err != nil {
+			_ = enc.Encode(brokerRequest{Op: "stdin"})
+			return
+		}
+	}
+}
+
+// runRemote submits the run to a broker, streams its stdin and output and cancels it on a signal
+func (r *Runner) runRemote(args []string) error {
+	conn, dec, err := r.sendBrokerRequest(brokerRequest{Op: "run", Args: r.remoteArgs(args)})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	go sendStdin(conn)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	idCh := make(chan string, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		var id string
+		select {
+		case id = <-idCh:
+		case <-done:
+			return
+		}
+		var sig os.Signal
+		select {
+		case sig = <-sigCh:
+		case <-done:
+			return
+		}
+		r.log.Printf("received signal %s, cancelling remote run %s\n", sig, id)
+		if c, _, err := r.sendBrokerRequest(brokerRequest{Op: "cancel", ID: id}); err != nil {
+			r.errLog.Println(err)
+		} else {
+			c.Close()
+		}
+	}()
+
+	for {
+		var msg brokerMessage
+		if err := dec.Decode(&msg); err != nil {
+			return errors.Wrap(err, "lost connection to broker")
+		}
+		switch {
+		case msg.Error != "":
+			return errors.New(msg.Error)
+		case msg.Stream == "stdout":
+			os.Stdout.Write(msg.Data)
+		case msg.Stream == "stderr":
+			os.Stderr.Write(msg.Data)
+		case msg.ExitCode != nil:
+			if *msg.ExitCode != 0 {
+				return &exitCodeError{code: *msg.ExitCode}
+			}
+			return nil
+		case msg.State == "running":
+			select {
+			case idCh <- msg.ID:
+			default:
+			}
+		}
+	}
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.remoteAddr, "remote", "", "submit the run to a broker at host:port (mutual TLS) or unix:/path")
+	for _, c := range []*cobra.Command{rootCmd, serveCmd} {
+		c.Flags().StringVar(&cliOptions.tlsCA, "tls-ca", "", "CA certificate for broker connections")
+		c.Flags().StringVar(&cliOptions.tlsCert, "tls-cert", "", "certificate for broker connections")
+		c.Flags().StringVar(&cliOptions.tlsKey, "tls-key", "", "key for broker connections")
+	}
+}
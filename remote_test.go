@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// testFlags is a flag set in which the given flags were set on the command line
+func testFlags(t *testing.T, changed ...string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	for _, name := range changed {
+		flags.String(name, "", "")
+		if err := flags.Set(name, "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return flags
+}
+
+// testCommand is a command with some of the run's flags, parsed from cmdline and then the environment
+func testCommand(t *testing.T, opts *options, cmdline []string) *cobra.Command {
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().StringVar(&opts.imageName, "image", opts.imageName, "")
+	cmd.Flags().StringVar(&opts.remoteAddr, "remote", "", "")
+	cmd.Flags().StringVar(&opts.tlsCA, "tls-ca", "", "")
+	cmd.Flags().StringArrayVarP(&opts.envVars, "env", "e", nil, "")
+	cmd.Flags().StringSliceVar(&opts.daemonHosts, "hosts", nil, "")
+	cmd.Flags().CountVarP(&opts.verbosity, "verbose", "v", "")
+	cmd.Flags().BoolVar(&opts.readOnlyRoot, "read-only", false, "")
+	if err := cmd.Flags().Parse(cmdline); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyEnvFlags(cmd, nil); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestRemoteArgs(t *testing.T) {
+	defer os.Unsetenv("RUNONCE_IMAGE")
+	defer os.Unsetenv("RUNONCE_ENV")
+	tests := []struct {
+		name    string
+		image   string
+		env     map[string]string
+		cmdline []string
+		args    []string
+		want    []string
+	}{
+		{
+			name:    "separate value",
+			cmdline: []string{"--image", "alpine", "--remote", "broker:7000", "--tls-ca", "ca.pem"},
+			args:    []string{"echo", "hi"},
+			want:    []string{"--image=alpine", "--", "echo", "hi"},
+		},
+		{
+			name:    "repeated and counted flags",
+			cmdline: []string{"--remote=broker:7000", "--image=alpine", "-vv", "-e", "A=1", "--env=B=2", "--read-only"},
+			want:    []string{"--env=A=1", "--env=B=2", "--image=alpine", "--read-only=true", "--verbose=2", "--"},
+		},
+		{
+			name:    "environment",
+			env:     map[string]string{"RUNONCE_IMAGE": "alpine", "RUNONCE_ENV": "A=1\nB=2"},
+			cmdline: []string{"--remote", "broker:7000"},
+			args:    []string{"--remote", "x"},
+			want:    []string{"--env=A=1", "--env=B=2", "--image=alpine", "--", "--remote", "x"},
+		},
+		{
+			name:    "image of the executable name",
+			image:   "tool",
+			cmdline: []string{"--remote", "broker:7000"},
+			args:    []string{"arg"},
+			want:    []string{"--image", "tool", "--", "arg"},
+		},
+	}
+	for _, tt := range tests {
+		for name, value := range tt.env {
+			os.Setenv(name, value)
+		}
+		opts := options{imageName: tt.image}
+		cmd := testCommand(t, &opts, tt.cmdline)
+		r := newRunner(opts)
+		r.flags = cmd.Flags()
+		if got := r.remoteArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: remoteArgs(%q) = %q, want %q", tt.name, tt.args, got, tt.want)
+		}
+		for name := range tt.env {
+			os.Unsetenv(name)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "export resource usage per image from the run history",
+	Long: `report aggregates the runs recorded with --history per image, for chargeback or capacity planning.
+CPU seconds and memory GiB-hours are measured from the container's stats while it runs.`,
+	Args: cobra.NoArgs,
+	RunE: runnerCommand((*Runner).showReport),
+}
+
+// imageUsage is the aggregate of the runs of an image
+type imageUsage struct {
+	Image       string  `json:"image"`
+	Runs        int     `json:"runs"`
+	Failures    int     `json:"failures"`
+	FailureRate float64 `json:"failureRate"`
+	Seconds     float64 `json:"wallSeconds"`
+	CPUSeconds  float64 `json:"cpuSeconds"`
+	MemoryHours float64 `json:"memoryGibHours"`
+}
+
+// parseReportDate takes a date, which is the start of that day in local time, or an RFC 3339 time
+func parseReportDate(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (r *Runner) showReport(cmd *cobra.Command, args []string) error {
+	var since, until time.Time
+	var err error
+	if r.reportSince != "" {
+		if since, err = parseReportDate(r.reportSince); err != nil {
+			return errors.Errorf("invalid --since '%s', expected YYYY-MM-DD or an RFC 3339 time", r.reportSince)
+		}
+	}
+	if r.reportUntil != "" {
+		if until, err = parseReportDate(r.reportUntil); err != nil {
+			return errors.Errorf("invalid --until '%s', expected YYYY-MM-DD or an RFC 3339 time", r.reportUntil)
+		}
+	}
+	if r.reportFormat != "csv" && r.reportFormat != "json" {
+		return errors.Errorf("invalid --format value '%s', expected csv or json", r.reportFormat)
+	}
+
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	entries, err := readHistory(path)
+	if err != nil {
+		return errors.Wrap(err, "cannot read run history")
+	}
+
+	byImage := make(map[string]*imageUsage)
+	for _, e := range entries {
+		if (!since.IsZero() && e.Start.Before(since)) || (!until.IsZero() && !e.Start.Before(until)) {
+			continue
+		}
+		u := byImage[e.Image]
+		if u == nil {
+			u = &imageUsage{Image: e.Image}
+			byImage[e.Image] = u
+		}
+		u.Runs++
+		if e.ExitCode != 0 {
+			u.Failures++
+		}
+		u.Seconds += e.Duration.Seconds()
+		u.CPUSeconds += e.CPUSeconds
+		u.MemoryHours += e.MemoryHours
+	}
+	usages := make([]*imageUsage, 0, len(byImage))
+	for _, u := range byImage {
+		u.FailureRate = float64(u.Failures) / float64(u.Runs)
+		usages = append(usages, u)
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Image < usages[j].Image })
+
+	if r.reportFormat == "json" {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(usages)
+	}
+	w := csv.NewWriter(cmd.OutOrStdout())
+	_ = w.Write([]string{"image", "runs", "failures", "failure_rate", "wall_seconds", "cpu_seconds", "memory_gib_hours"})
+	for _, u := range usages {
+		_ = w.Write([]string{
+			u.Image,
+			strconv.Itoa(u.Runs),
+			strconv.Itoa(u.Failures),
+			strconv.FormatFloat(u.FailureRate, 'f', 4, 64),
+			strconv.FormatFloat(u.Seconds, 'f', 1, 64),
+			strconv.FormatFloat(u.CPUSeconds, 'f', 1, 64),
+			strconv.FormatFloat(u.MemoryHours, 'f', 4, 64),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func init() {
+	reportCmd.Flags().StringVar(&cliOptions.reportSince, "since", "", "only runs started at or after this date, YYYY-MM-DD or RFC 3339")
+	reportCmd.Flags().StringVar(&cliOptions.reportUntil, "until", "", "only runs started before this date, YYYY-MM-DD or RFC 3339")
+	reportCmd.Flags().StringVar(&cliOptions.reportFormat, "format", "csv", "output format: csv or json")
+	rootCmd.AddCommand(reportCmd)
+}
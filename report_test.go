@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReportDate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "2024-03-01", want: time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)},
+		{in: "2024-03-01T12:30:00Z", want: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)},
+		{in: "2024-03-01T12:30:00+02:00", want: time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)},
+		{in: "03/01/2024", wantErr: true},
+		{in: "2024-13-01", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseReportDate(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseReportDate(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !got.Equal(tt.want) {
+			t.Errorf("parseReportDate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	docker_t "docker.io/go-docker/api/types"
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+// isHostRelative reports whether a resource value needs the host capacity to be resolved
+func isHostRelative(value string) bool {
+	return strings.HasSuffix(value, "%") || value == "auto"
+}
+
+func parsePercentage(value string) (float64, error) {
+	pct, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if pct <= 0 || pct > 100 {
+		return 0, errors.Errorf("percentage %s out of range", value)
+	}
+	return pct / 100, nil
+}
+
+// parseMemorySize parses an absolute size or a percentage of the host memory
+func parseMemorySize(value string, info *docker_t.Info) (uint64, error) {
+	if value == "none" {
+		return 0, nil
+	}
+	if !strings.HasSuffix(value, "%") {
+		return humanize.ParseBytes(value)
+	}
+	fraction, err := parsePercentage(value)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(float64(info.MemTotal) * fraction), nil
+}
+
+// parseCPUs parses a CPU count, a percentage of the host CPUs, or auto for all of them, as nano CPUs
+func parseCPUs(value string, info *docker_t.Info) (int64, error) {
+	var cpus float64
+	switch {
+	case value == "":
+		return 0, nil
+	case value == "auto":
+		cpus = float64(info.NCPU)
+	case strings.HasSuffix(value, "%"):
+		fraction, err := parsePercentage(value)
+		if err != nil {
+			return 0, err
+		}
+		cpus = float64(info.NCPU) * fraction
+	default:
+		var err error
+		if cpus, err = strconv.ParseFloat(value, 64); err != nil {
+			return 0, err
+		}
+		if cpus <= 0 {
+			return 0, errors.Errorf("cpu count must be positive")
+		}
+	}
+	return int64(cpus * 1e9), nil
+}
+
+// cpuSharesPresets and blkioWeightPresets relate to the daemon's defaults of 1024 shares and weight 500
+var (
+	cpuSharesPresets   = map[string]int64{"low": 256, "normal": 1024, "high": 4096}
+	blkioWeightPresets = map[string]uint16{"low": 100, "normal": 500, "high": 1000}
+)
+
+// parsePresets resolves the --cpu-shares-preset and --blkio-weight-preset values, 0 if unset
+func parsePresets(cpuPreset, blkioPreset string) (int64, uint16, error) {
+	var shares int64
+	var weight uint16
+	var ok bool
+	if cpuPreset != "" {
+		if shares, ok = cpuSharesPresets[cpuPreset]; !ok {
+			return 0, 0, errors.Errorf("invalid --cpu-shares-preset value '%s', expected low, normal or high", cpuPreset)
+		}
+	}
+	if blkioPreset != "" {
+		if weight, ok = blkioWeightPresets[blkioPreset]; !ok {
+			return 0, 0, errors.Errorf("invalid --blkio-weight-preset value '%s', expected low, normal or high", blkioPreset)
+		}
+	}
+	return shares, weight, nil
+}
+
+// checkMemoryLimit warns about a memory limit beyond the host's memory or below the floor
+func (r *Runner) checkMemoryLimit(limit, floor uint64, info *docker_t.Info) {
+	if info.MemTotal > 0 && limit > uint64(info.MemTotal) {
+		r.log.Printf("memory limit %s exceeds the host's memory of %s\n", r.formatBytes(limit), r.formatBytes(uint64(info.MemTotal)))
+	}
+	if limit < floor {
+		r.log.Printf("memory limit %s is below the minimum of %s\n", r.formatBytes(limit), r.formatBytes(floor))
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// runResult describes a finished run; it is the data of --format templates
+type runResult struct {
+	RunID        string          `json:"runId"`
+	Image        string          `json:"image"`
+	ImageDigest  string          `json:"imageDigest"`
+	ContainerID  string          `json:"containerId,omitempty"`
+	Args         []string        `json:"args"`
+	Host         string          `json:"host"`
+	DaemonHost   string          `json:"daemonHost,omitempty"`
+	Start        time.Time       `json:"start"`
+	End          time.Time       `json:"end"`
+	Duration     time.Duration   `json:"duration"`
+	ExitCode     int             `json:"exitCode"`
+	TimedOut     bool            `json:"timedOut"`
+	OOMKilled    bool            `json:"oomKilled"`
+	CPUExceeded  bool            `json:"cpuTimeExceeded"`
+	Error        string          `json:"error,omitempty"`
+	OutputDigest string          `json:"outputDigest,omitempty"`
+	DaemonEvents []daemonEvent   `json:"daemonEvents,omitempty"`
+	Warnings     []createWarning `json:"warnings,omitempty"`
+	Cleanup      string          `json:"cleanup,omitempty"`
+	CPUSeconds   float64         `json:"cpuSeconds,omitempty"`
+	MemoryHours  float64         `json:"memoryGibHours,omitempty"`
+
+	stderrTail *tailBuffer
+	outputTail *tailBuffer
+	stdoutHash hash.Hash
+	oomFlag    int32
+	cpuFlag    int32
+	eventsMu   sync.Mutex
+	events     []daemonEvent
+
+	usageMu           sync.Mutex
+	cpuTime           time.Duration
+	memoryByteSeconds float64
+}
+
+// daemonEvent is a container event of the daemon relevant to how the run ended
+type daemonEvent struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Signal   string    `json:"signal,omitempty"`
+	ExitCode string    `json:"exitCode,omitempty"`
+}
+
+// addDaemonEvent is called from the event watcher goroutine
+func (r *runResult) addDaemonEvent(e daemonEvent) {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// markOOM records an OOM kill; it is called from the event watcher goroutine
+func (r *runResult) markOOM() {
+	atomic.StoreInt32(&r.oomFlag, 1)
+}
+
+func (r *runResult) oomKilled() bool {
+	return atomic.LoadInt32(&r.oomFlag) == 1
+}
+
+// markCPUTimeExceeded records a kill by the CPU time watcher
+func (r *runResult) markCPUTimeExceeded() {
+	atomic.StoreInt32(&r.cpuFlag, 1)
+}
+
+func (r *runResult) cpuTimeExceeded() bool {
+	return atomic.LoadInt32(&r.cpuFlag) == 1
+}
+
+// resultFuncs are the functions of --format and notification templates
+func (r *Runner) resultFuncs() template.FuncMap {
+	return template.FuncMap{
+		"duration": r.formatDuration,
+		"bytes":    r.formatBytes,
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}
+}
+
+// parseResultFormat validates the --format template before anything is run
+func (r *Runner) parseResultFormat() (*template.Template, error) {
+	tmpl, err := template.New("format").Funcs(r.resultFuncs()).Parse(r.resultFormat)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid format template")
+	}
+	return tmpl, nil
+}
+
+// finishRun completes the result of a run and records and reports it
+func (r *Runner) finishRun(result *runResult, err error) {
+	result.End = time.Now()
+	result.Duration = result.End.Sub(result.Start)
+	result.ExitCode = exitCode(err)
+	result.OOMKilled = result.oomKilled()
+	result.CPUExceeded = result.cpuTimeExceeded()
+	result.eventsMu.Lock()
+	result.DaemonEvents = append([]daemonEvent(nil), result.events...)
+	result.eventsMu.Unlock()
+	result.usageMu.Lock()
+	result.CPUSeconds = result.cpuTime.Seconds()
+	result.MemoryHours = result.memoryByteSeconds / (1 << 30) / 3600
+	result.usageMu.Unlock()
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if r.fallsBack(err) {
+		// the run with the fallback image is reported instead
+		return
+	}
+	if result.stdoutHash != nil {
+		result.OutputDigest = fmt.Sprintf("%s:%x", r.outputDigest, result.stdoutHash.Sum(nil))
+		r.log.Printf("stdout digest %s\n", result.OutputDigest)
+	}
+
+	r.ghaReport(result)
+
+	if r.historyEnabled {
+		if herr := r.recordHistory(historyEntry{
+			RunID:    result.RunID,
+			Image:    result.Image,
+			Digest:   result.ImageDigest,
+			ArgsHash: argsHash(result.Args),
+			Key:      r.dedupeKey,
+			Start:    result.Start,
+			End:      result.End,
+			ExitCode: result.ExitCode,
+			Duration: result.Duration,
+			Host:     result.Host,
+			Error:    result.Error,
+
+			CPUSeconds:  result.CPUSeconds,
+			MemoryHours: result.MemoryHours,
+		}); herr != nil {
+			r.log.Printf("cannot record run history: %v\n", herr)
+		}
+	}
+
+	if r.junitPath != "" {
+		if jerr := writeJUnit(r.junitPath, result, result.stderrTail.String()); jerr != nil {
+			r.log.Printf("cannot write JUnit report: %v\n", jerr)
+		}
+	}
+
+	if r.resultFormat != "" {
+		if ferr := r.writeResult(result); ferr != nil {
+			r.log.Printf("cannot write result: %v\n", ferr)
+		}
+	}
+
+	if len(r.mailTo) > 0 {
+		if merr := r.sendRunMail(result); merr != nil {
+			r.log.Printf("cannot send mail: %v\n", merr)
+		}
+	}
+
+	if r.profileNotify != nil {
+		if nerr := r.profileNotify.notify(result, r.resultFuncs()); nerr != nil {
+			r.log.Printf("cannot send notification: %v\n", nerr)
+		}
+	}
+}
+
+// writeResult renders the --format template to stderr or the --format-file
+func (r *Runner) writeResult(result *runResult) error {
+	tmpl, err := r.parseResultFormat()
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stderr
+	if r.resultFormatFile != "" {
+		f, err := os.Create(r.resultFormatFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := tmpl.Execute(w, result); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.resultFormat, "format", "", "print a summary of the run using a Go template, e.g. '{{.ExitCode}} {{duration .Duration}}' or '{{json .}}'")
+	rootCmd.Flags().StringVar(&cliOptions.resultFormatFile, "format-file", "", "write the --format summary to this file instead of stderr")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/mkke/go-mlog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Runner runs a job with options and state of its own, so that several runs can go on in one process
+type Runner struct {
+	options
+
+	// flags are the flags the options were parsed from, nil if they were not given on a command line
+	flags *pflag.FlagSet
+
+	log    mlog.Logger
+	errLog mlog.Logger
+
+	// containerStdin is forwarded to the container on the first attach
+	containerStdin io.Reader
+	// dockerEnv overrides the environment variables configuring the docker client, see setDaemonEnv
+	dockerEnv map[string]string
+
+	// fallbackAttempt is set while running with the --fallback-image
+	fallbackAttempt bool
+	// profileNotify is the notifier of the applied profile, if it has one
+	profileNotify *notifyConfig
+	// jobHooks are hook executables named by the job file, used instead of the plugins directory
+	jobHooks map[string]string
+	// exitCodeMap translates container exit codes to exit codes of the run, from --map-exit-code
+	exitCodeMap map[int]int
+	// pullPlatform selects the platform of image pulls, empty for the daemon's own
+	pullPlatform string
+	runEvents    *eventSink
+	pickedHost   string
+	// debug is the state of the run served on --debug-listen
+	debug debugRun
+}
+
+// newRunner returns a runner of opts; the runs of a runner do not change the options it was created from
+func newRunner(opts options) *Runner {
+	for _, list := range []*[]string{
+		&opts.envVars, &opts.volumeBinds, &opts.sysctls, &opts.sidecars, &opts.exitCodeMappings,
+		&opts.requireAttestation, &opts.captureDirSpecs, &opts.daemonHosts, &opts.mailTo,
+		&opts.nomadDatacenters, &opts.writablePaths,
+	} {
+		*list = append([]string(nil), *list...)
+	}
+	return &Runner{
+		options:        opts,
+		log:            log,
+		errLog:         errLog,
+		containerStdin: os.Stdin,
+		dockerEnv:      make(map[string]string),
+	}
+}
+
+// cliRunner returns a runner of the options given on the command line of cmd
+func cliRunner(cmd *cobra.Command) *Runner {
+	r := newRunner(cliOptions)
+	r.flags = cmd.Flags()
+	return r
+}
+
+// runnerCommand adapts a runner method to a cobra command, running it with the command line options
+func runnerCommand(run func(r *Runner, cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		return run(cliRunner(cmd), cmd, args)
+	}
+}
+
+// changed reports whether the flag was given, overriding other sources of the option
+func (r *Runner) changed(flag string) bool {
+	return r.flags != nil && r.flags.Changed(flag)
+}
+
+// getenv is os.Getenv with the variables of dockerEnv applied
+func (r *Runner) getenv(name string) string {
+	if v, ok := r.dockerEnv[name]; ok {
+		return v
+	}
+	return os.Getenv(name)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRunnersSideBySide(t *testing.T) {
+	dir := t.TempDir()
+	base := options{
+		imageName:   "base:latest",
+		envVars:     []string{"SHARED=1"},
+		rmMode:      "always",
+		cleanupMode: "kill",
+	}
+
+	runners := make([]*Runner, 2)
+	for i := range runners {
+		configPath := filepath.Join(dir, fmt.Sprintf("config%d.yml", i))
+		config := fmt.Sprintf("profiles:\n  job:\n    image: job%d:1\n    env: [\"RUNNER=%d\"]\n    memory-limit: %dMi\n", i, i, 64*(i+1))
+		if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		opts := base
+		opts.configPath, opts.profileName, opts.keepOnError = configPath, "job", i == 1
+		runners[i] = newRunner(opts)
+	}
+	// the second runner was given --memory-limit, which the profile does not override
+	runners[1].flags = testFlags(t, "memory-limit")
+	runners[1].memoryLimit = "1Gi"
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(runners))
+	for i, r := range runners {
+		wg.Add(1)
+		go func(i int, r *Runner) {
+			defer wg.Done()
+			r.setDaemonEnv([]string{fmt.Sprintf("DOCKER_HOST=tcp://host%d:2376", i)})
+			if _, err := r.applyProfile(nil); err != nil {
+				errs[i] = err
+				return
+			}
+			r.exitCodeMappings = append(r.exitCodeMappings, fmt.Sprintf("%d=0", i+1))
+			errs[i] = r.checkCleanupOptions(r.changed("rm"))
+		}(i, r)
+	}
+	wg.Wait()
+
+	for i, r := range runners {
+		if errs[i] != nil {
+			t.Fatalf("runner %d: %v", i, errs[i])
+		}
+		if want := fmt.Sprintf("job%d:1", i); r.imageName != want {
+			t.Errorf("runner %d: image = %q, want %q", i, r.imageName, want)
+		}
+		if want := []string{fmt.Sprintf("RUNNER=%d", i), "SHARED=1"}; !reflect.DeepEqual(r.envVars, want) {
+			t.Errorf("runner %d: env = %q, want %q", i, r.envVars, want)
+		}
+		if want := []string{fmt.Sprintf("%d=0", i+1)}; !reflect.DeepEqual(r.exitCodeMappings, want) {
+			t.Errorf("runner %d: exit code mappings = %q, want %q", i, r.exitCodeMappings, want)
+		}
+		if want := fmt.Sprintf("tcp://host%d:2376", i); r.getenv("DOCKER_HOST") != want {
+			t.Errorf("runner %d: DOCKER_HOST = %q, want %q", i, r.getenv("DOCKER_HOST"), want)
+		}
+	}
+	if runners[0].memoryLimit != "64Mi" || runners[1].memoryLimit != "1Gi" {
+		t.Errorf("memory limits = %q, %q, want 64Mi, 1Gi", runners[0].memoryLimit, runners[1].memoryLimit)
+	}
+	if runners[0].rmMode != "always" || runners[1].rmMode != "on-success" {
+		t.Errorf("rm modes = %q, %q, want always, on-success", runners[0].rmMode, runners[1].rmMode)
+	}
+	if base.imageName != "base:latest" || !reflect.DeepEqual(base.envVars, []string{"SHARED=1"}) {
+		t.Errorf("the options the runners were created from changed: %+v", base)
+	}
+}
+
+func TestSetDaemonEnvRestore(t *testing.T) {
+	r := newRunner(options{})
+	r.setDaemonEnv([]string{"DOCKER_HOST=tcp://picked:2376"})
+	restore := r.setDaemonEnv([]string{"DOCKER_HOST=tcp://probe:2376", "DOCKER_TLS_VERIFY=1"})
+	if got := r.getenv("DOCKER_HOST"); got != "tcp://probe:2376" {
+		t.Errorf("DOCKER_HOST = %q while probing", got)
+	}
+	restore()
+	if got := r.getenv("DOCKER_HOST"); got != "tcp://picked:2376" {
+		t.Errorf("DOCKER_HOST = %q after restoring", got)
+	}
+	if _, ok := r.dockerEnv["DOCKER_TLS_VERIFY"]; ok {
+		t.Error("DOCKER_TLS_VERIFY kept after restoring")
+	}
+}
+
+// fakeNomad serves the part of the Nomad API runNomad uses; a job's task exits with its EXIT
+// variable once release is closed
+type fakeNomad struct {
+	release chan struct{}
+
+	mu   sync.Mutex
+	jobs map[string]map[string]interface{}
+}
+
+func (n *fakeNomad) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	path := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case req.Method == http.MethodPut && req.URL.Path == "/v1/jobs":
+		var body struct{ Job map[string]interface{} }
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n.jobs[body.Job["ID"].(string)] = body.Job
+	case len(path) == 4 && path[1] == "job" && path[3] == "allocations":
+		_ = json.NewEncoder(w).Encode([]nomadAllocation{{ID: path[2]}})
+	case len(path) == 3 && path[1] == "allocation":
+		alloc := map[string]interface{}{"ID": path[2], "ClientStatus": "running"}
+		select {
+		case <-n.release:
+			task := n.task(path[2])
+			code, _ := strconv.Atoi(task["Env"].(map[string]interface{})["EXIT"].(string))
+			alloc["ClientStatus"] = "complete"
+			alloc["TaskStates"] = map[string]interface{}{nomadTask: map[string]interface{}{
+				"State": "dead", "Events": []interface{}{map[string]interface{}{"Type": "Terminated", "ExitCode": code}},
+			}}
+		default:
+		}
+		_ = json.NewEncoder(w).Encode(alloc)
+	case req.Method == http.MethodDelete && len(path) == 3 && path[1] == "job":
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// task returns the single task of a submitted job
+func (n *fakeNomad) task(jobID string) map[string]interface{} {
+	group := n.jobs[jobID]["TaskGroups"].([]interface{})[0].(map[string]interface{})
+	return group["Tasks"].([]interface{})[0].(map[string]interface{})
+}
+
+var debugAddrRegexp = regexp.MustCompile(`debug endpoints on http://([^/]+)/`)
+
+// waitDebugState reads the state a run serves on --debug-listen, at the address it logged
+func waitDebugState(logPath string) (map[string]interface{}, error) {
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		data, _ := ioutil.ReadFile(logPath)
+		m := debugAddrRegexp.FindSubmatch(data)
+		if m == nil {
+			continue
+		}
+		resp, err := http.Get("http://" + string(m[1]) + "/debug/run")
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		var state map[string]interface{}
+		return state, json.NewDecoder(resp.Body).Decode(&state)
+	}
+	return nil, errors.Errorf("no debug endpoint logged to %s", logPath)
+}
+
+func TestConcurrentRuns(t *testing.T) {
+	nomad := &fakeNomad{release: make(chan struct{}), jobs: map[string]map[string]interface{}{}}
+	srv := httptest.NewServer(nomad)
+	defer srv.Close()
+	defer func(addr string) { os.Setenv("NOMAD_ADDR", addr) }(os.Getenv("NOMAD_ADDR"))
+	os.Setenv("NOMAD_ADDR", srv.URL)
+
+	dir := t.TempDir()
+	runners := make([]*Runner, 2)
+	for i := range runners {
+		configPath := filepath.Join(dir, fmt.Sprintf("config%d.yml", i))
+		config := fmt.Sprintf("profiles:\n  job:\n    image: job%d\n    env: [\"EXIT=%d\"]\n", i, 3*i)
+		if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		runners[i] = newRunner(options{
+			backendName:      "nomad",
+			configPath:       configPath,
+			profileName:      "job",
+			timeout:          "1m",
+			memoryLimit:      "64Mi",
+			cleanupTimeout:   5 * time.Second,
+			logTarget:        "file:" + filepath.Join(dir, fmt.Sprintf("run%d.log", i)),
+			logFacility:      "user",
+			debugListen:      "127.0.0.1:0",
+			resultFormat:     "{{.RunID}} {{.Image}} {{.ExitCode}} {{bytes 1536}}",
+			resultFormatFile: filepath.Join(dir, fmt.Sprintf("result%d", i)),
+			rawUnits:         i == 1,
+		})
+	}
+
+	errs := make([]error, len(runners))
+	var wg sync.WaitGroup
+	for i, r := range runners {
+		wg.Add(1)
+		go func(i int, r *Runner) {
+			defer wg.Done()
+			errs[i] = r.run(nil)
+		}(i, r)
+	}
+
+	// both runs are submitted and wait for their tasks; each serves its own state meanwhile
+	runIDs := make([]string, len(runners))
+	for i := range runners {
+		state, err := waitDebugState(filepath.Join(dir, fmt.Sprintf("run%d.log", i)))
+		if err != nil {
+			close(nomad.release)
+			wg.Wait()
+			t.Fatalf("runner %d: %v (run: %v)", i, err, errs[i])
+		}
+		if want := fmt.Sprintf("job%d:latest", i); state["image"] != want {
+			t.Errorf("runner %d: debug state image = %v, want %s", i, state["image"], want)
+		}
+		runIDs[i], _ = state["runId"].(string)
+	}
+	close(nomad.release)
+	wg.Wait()
+
+	if runIDs[0] == "" || runIDs[0] == runIDs[1] {
+		t.Errorf("run ids = %q", runIDs)
+	}
+	var exitErr *exitCodeError
+	if errs[0] != nil {
+		t.Errorf("runner 0: %v", errs[0])
+	}
+	if !errors.As(errs[1], &exitErr) || exitErr.code != 3 {
+		t.Errorf("runner 1: error = %v, want exit code 3", errs[1])
+	}
+	for i := range runners {
+		jobID := "runonce-" + runIDs[i][:8]
+		nomad.mu.Lock()
+		task := nomad.task(jobID)
+		nomad.mu.Unlock()
+		if image := task["Config"].(map[string]interface{})["image"]; image != fmt.Sprintf("job%d:latest", i) {
+			t.Errorf("runner %d: submitted image %v", i, image)
+		}
+		result, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("result%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := fmt.Sprintf("%s job%d:latest %d %s\n", runIDs[i], i, 3*i, []string{"1.5 KiB", "1536"}[i])
+		if string(result) != want {
+			t.Errorf("runner %d: result = %q, want %q", i, result, want)
+		}
+		logged, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("run%d.log", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(logged), jobID) || strings.Contains(string(logged), runIDs[1-i][:8]) {
+			t.Errorf("runner %d: log does not belong to its run alone:\n%s", i, logged)
+		}
+	}
+}
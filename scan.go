@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// severities in increasing order, as both trivy and grype name them
+var severities = []string{"unknown", "negligible", "low", "medium", "high", "critical"}
+
+func severityRank(severity string) int {
+	severity = strings.ToLower(severity)
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return 0
+}
+
+// scanResult is the number of findings per severity of an image, cached by image id
+type scanResult struct {
+	Scanner string         `json:"scanner"`
+	Time    time.Time      `json:"time"`
+	Counts  map[string]int `json:"counts"`
+}
+
+func scanCachePath(imageID string) (string, error) {
+	path, err := historyPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "scans", strings.TrimPrefix(imageID, "sha256:")+".json"), nil
+}
+
+// cachedScan returns the cached result of the scanner if it is less than --scan-max-age old
+func (r *Runner) cachedScan(imageID, name string) (*scanResult, bool) {
+	path, err := scanCachePath(imageID)
+	if err != nil {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var result scanResult
+	if json.Unmarshal(data, &result) != nil || result.Scanner != name || time.Since(result.Time) > r.scanMaxAge {
+		return nil, false
+	}
+	return &result, true
+}
+
+func storeScan(imageID string, result *scanResult) error {
+	path, err := scanCachePath(imageID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// findScanner returns the --scanner or the first of trivy and grype on PATH
+func (r *Runner) findScanner() (string, error) {
+	if r.scanner != "" {
+		if r.scanner != "trivy" && r.scanner != "grype" {
+			return "", errors.Errorf("invalid --scanner value '%s', expected trivy or grype", r.scanner)
+		}
+		if _, err := exec.LookPath(r.scanner); err != nil {
+			return "", errors.Wrapf(err, "scanner %s not found", r.scanner)
+		}
+		return r.scanner, nil
+	}
+	for _, name := range []string{"trivy", "grype"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return name, nil
+		}
+	}
+	return "", errors.New("--scan needs trivy or grype on PATH")
+}
+
+// runScanner scans the local image and counts its vulnerabilities per severity
+func runScanner(ctx context.Context, name, image string) (map[string]int, error) {
+	var cmd *exec.Cmd
+	if name == "trivy" {
+		cmd = exec.CommandContext(ctx, "trivy", "image", "--quiet", "--format", "json", image)
+	} else {
+		cmd = exec.CommandContext(ctx, "grype", "--quiet", "--output", "json", "docker:"+image)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s failed: %s", name, strings.TrimSpace(stderr.String()))
+	}
+
+	counts := make(map[string]int)
+	if name == "trivy" {
+		var report struct {
+			Results []struct {
+				Vulnerabilities []struct {
+					Severity string `json:"Severity"`
+				} `json:"Vulnerabilities"`
+			} `json:"Results"`
+		}
+		if err := json.Unmarshal(out, &report); err != nil {
+			return nil, errors.Wrap(err, "cannot parse trivy report")
+		}
+		for _, r := range report.Results {
+			for _, v := range r.Vulnerabilities {
+				counts[strings.ToLower(v.Severity)]++
+			}
+		}
+	} else {
+		var report struct {
+			Matches []struct {
+				Vulnerability struct {
+					Severity string `json:"severity"`
+				} `json:"vulnerability"`
+			} `json:"matches"`
+		}
+		if err := json.Unmarshal(out, &report); err != nil {
+			return nil, errors.Wrap(err, "cannot parse grype report")
+		}
+		for _, m := range report.Matches {
+			counts[strings.ToLower(m.Vulnerability.Severity)]++
+		}
+	}
+	return counts, nil
+}
+
+// checkScan refuses images with findings above --max-severity; results are cached per
+// image id since scanning takes long and the id changes with the content
+func (r *Runner) checkScan(ctx context.Context, image, imageID string) error {
+	name, err := r.findScanner()
+	if err != nil {
+		return err
+	}
+	result, ok := r.cachedScan(imageID, name)
+	if ok {
+		r.log.Printf("using %s scan of %s from %s\n", name, image, result.Time.Format(time.RFC3339))
+	} else {
+		r.log.Printf("scanning %s with %s\n", image, name)
+		counts, err := runScanner(ctx, name, image)
+		if err != nil {
+			return err
+		}
+		result = &scanResult{Scanner: name, Time: time.Now(), Counts: counts}
+		if err := storeScan(imageID, result); err != nil {
+			r.log.Printf("cannot cache scan result: %v\n", err)
+		}
+	}
+
+	limit := severityRank(r.maxSeverity)
+	var exceeding []string
+	for severity, n := range result.Counts {
+		if severityRank(severity) > limit && n > 0 {
+			exceeding = append(exceeding, fmt.Sprintf("%d %s", n, severity))
+		}
+	}
+	if len(exceeding) > 0 {
+		sort.Strings(exceeding)
+		return errors.Wrapf(ErrPolicyDenied, "image '%s' has findings above %s severity: %s",
+			image, r.maxSeverity, strings.Join(exceeding, ", "))
+	}
+	return nil
+}
+
+func (r *Runner) checkScanOptions() error {
+	if severityRank(r.maxSeverity) == 0 && strings.ToLower(r.maxSeverity) != "unknown" {
+		return errors.Errorf("invalid --max-severity value '%s', expected one of %s", r.maxSeverity, strings.Join(severities, ", "))
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.Flags().BoolVar(&cliOptions.scanImage, "scan", false, "scan the image for vulnerabilities with trivy or grype before running it")
+	rootCmd.Flags().StringVar(&cliOptions.scanner, "scanner", "", "scanner for --scan: trivy or grype (default: the first found on PATH)")
+	rootCmd.Flags().StringVar(&cliOptions.maxSeverity, "max-severity", "high", "highest vulnerability severity --scan accepts")
+	rootCmd.Flags().DurationVar(&cliOptions.scanMaxAge, "scan-max-age", 24*time.Hour, "reuse cached scan results of the image for this long")
+}
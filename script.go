@@ -0,0 +1,59 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"github.com/pkg/errors"
+)
+
+// scriptPath is where the script is placed in the container; / exists in every image
+const scriptPath = "/.runonce-script"
+
+// readScript returns the script to run, or nil without --script/--script-file
+func (r *Runner) readScript() ([]byte, error) {
+	switch {
+	case r.scriptFromStdin && r.scriptFile != "":
+		return nil, errors.New("--script and --script-file are mutually exclusive")
+	case r.scriptFile != "":
+		return ioutil.ReadFile(r.scriptFile)
+	case r.scriptFromStdin:
+		script, err := ioutil.ReadAll(os.Stdin)
+		return script, errors.Wrap(err, "cannot read script from stdin")
+	}
+	return nil, nil
+}
+
+// copyScript places the script as an executable file in the created container
+func copyScript(ctx context.Context, docker *docker_cli.Client, containerId string, script []byte) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    path.Base(scriptPath),
+		Mode:    0755,
+		Size:    int64(len(script)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(script); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	err := docker.CopyToContainer(ctx, containerId, path.Dir(scriptPath), &buf, docker_t.CopyToContainerOptions{})
+	return errors.Wrap(err, "cannot copy script into container")
+}
+
+func init() {
+	rootCmd.Flags().BoolVar(&cliOptions.scriptFromStdin, "script", false, "read a shell script from stdin and run it in the container with the arguments as $1...")
+	rootCmd.Flags().StringVar(&cliOptions.scriptFile, "script-file", "", "run this shell script in the container with the arguments as $1...")
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// brokerClientFlags are the flags clients may give; all others are refused, as they name host paths,
+// mounts, devices, addresses or notifications the broker would act on with its own privileges
+var brokerClientFlags = map[string]bool{
+	"image": true, "env": true, "profile": true, "name": true, "on-conflict": true, "concurrent": true,
+	"memory-limit": true, "memory-swap": true, "memory-reservation": true, "memory-swappiness": true,
+	"cpus": true, "cpu-shares-preset": true, "blkio-weight-preset": true, "cpu-time-limit": true, "shm-size": true,
+	"io-rate-limit": true, "read-only": true, "writable": true, "timeout": true, "stop-timeout": true,
+	"stop-signal": true, "window": true, "window-wait": true, "splay": true, "rm": true, "cleanup": true,
+	"no-tty": true, "force-tty": true, "verbose": true, "quiet": true, "prefix": true, "timestamps": true,
+	"color": true, "raw-units": true, "heartbeat": true, "stdin-progress": true, "reattach-retries": true,
+	"pull-retries": true, "fail-on-regex": true, "success-regex": true, "map-exit-code": true,
+	"fail-on-warnings": true, "ignore-labels": true, "strict-labels": true, "scan": true, "max-severity": true,
+	"require-attestation": true,
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "accept runs from clients over a Unix socket or mutual TLS",
+	Long: `serve listens on a Unix socket, or with --listen on a TCP address requiring client
+certificates, for newline-delimited JSON requests, one per connection:
+
+  {"op": "run", "args": ["--image", "alpine", "echo", "hi"]}
+      streams {"id", "stream": "stdout"|"stderr", "data": <base64>} messages and
+      finally {"id", "state": "exited", "exitCode"}
+      followed on the same connection by {"op": "stdin", "data": <base64>} messages
+      forwarding the run's stdin, and one without data at its end
+  {"op": "status", "id": "..."}
+  {"op": "cancel", "id": "..."}
+
+Runs can only be queried and cancelled by the client that submitted them, identified by the
+uid of its process on the Unix socket and by the subject of its certificate with TLS. A run
+whose client is gone is stopped.
+
+Each run is executed by the broker with its own privileges, subject to the policy file,
+which serve requires. The socket is only accessible to the members of --socket-group.
+Clients submit runs with --remote.`,
+	Args: cobra.NoArgs,
+	RunE: runnerCommand((*Runner).serve),
+}
+
+type brokerRequest struct {
+	Op   string   `json:"op"`
+	Args []string `json:"args,omitempty"`
+	ID   string   `json:"id,omitempty"`
+	Data []byte   `json:"data,omitempty"`
+}
+
+type brokerMessage struct {
+	ID       string `json:"id,omitempty"`
+	Stream   string `json:"stream,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+	State    string `json:"state,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type brokeredRun struct {
+	cmd *exec.Cmd
+	// submitter identifies the client that submitted the run, the only one that may query or cancel it
+	submitter string
+	done      chan struct{}
+	exitCode  int
+	// stopOnce stops the run when its client is gone
+	stopOnce sync.Once
+}
+
+type broker struct {
+	mu   sync.Mutex
+	runs map[string]*brokeredRun
+}
+
+// brokerStream forwards one output stream of a run to the client; writing fails once the client is gone
+type brokerStream struct {
+	mu     *sync.Mutex
+	enc    *json.Encoder
+	id     string
+	stream string
+}
+
+func (s *brokerStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(brokerMessage{ID: s.id, Stream: s.stream, Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// lookupRootFlag finds a flag of the run command, including its persistent flags
+func lookupRootFlag(name string, shorthand bool) *pflag.Flag {
+	for _, flags := range []*pflag.FlagSet{rootCmd.Flags(), rootCmd.PersistentFlags()} {
+		var f *pflag.Flag
+		if shorthand {
+			f = flags.ShorthandLookup(name)
+		} else {
+			f = flags.Lookup(name)
+		}
+		if f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// isSubcommand reports whether name selects a subcommand instead of a run
+func isSubcommand(name string) bool {
+	for _, c := range rootCmd.Commands() {
+		if c.Name() == name {
+			return true
+		}
+		for _, alias := range c.Aliases {
+			if alias == name {
+				return true
+			}
+		}
+	}
+	return name == "help"
+}
+
+// checkBrokerArgs refuses flags not in brokerClientFlags up to the --, and a first argument naming
+// a subcommand; flag values are skipped, so that a value looking like a flag is not mistaken for one
+func checkBrokerArgs(args []string) error {
+	positional := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			if !positional && isSubcommand(arg) {
+				return errors.Errorf("subcommand '%s' is not allowed through the broker", arg)
+			}
+			positional = true
+			continue
+		}
+		if strings.HasPrefix(arg, "--") {
+			name, hasValue := arg[2:], false
+			if j := strings.Index(name, "="); j >= 0 {
+				name, hasValue = name[:j], true
+			}
+			f := lookupRootFlag(name, false)
+			if f == nil || !brokerClientFlags[f.Name] {
+				return errors.Errorf("flag --%s is not allowed through the broker", name)
+			}
+			if f.NoOptDefVal == "" && !hasValue {
+				i++
+			}
+			continue
+		}
+		// the first shorthand of a cluster taking a value takes the rest of it, or the next argument
+		for j := 1; j < len(arg); j++ {
+			f := lookupRootFlag(arg[j:j+1], true)
+			if f == nil || !brokerClientFlags[f.Name] {
+				return errors.Errorf("flag -%c is not allowed through the broker", arg[j])
+			}
+			if f.NoOptDefVal == "" {
+				if j == len(arg)-1 {
+					i++
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// start runs the request's command line for the submitter; its stdin is written to the returned pipe
+func (b *broker) start(submitter string, args []string, stdout, stderr *brokerStream) (string, *brokeredRun, *os.File, error) {
+	if err := checkBrokerArgs(args); err != nil {
+		return "", nil, nil, err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	defer stdinR.Close()
+	id := newRunID()
+	stdout.id, stderr.id = id, id
+	// @path arguments would have the broker read its own files for the client; the client cannot
+	// turn them on again, --file-args is not in brokerClientFlags
+	cmd := exec.Command(exe, append([]string{"--bind-cwd=", "--file-args=false"}, args...)...)
+	cmd.Stdin = stdinR
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		stdinW.Close()
+		return "", nil, nil, err
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		stdinW.Close()
+		return "", nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		stdinW.Close()
+		return "", nil, nil, err
+	}
+	r := &brokeredRun{cmd: cmd, submitter: submitter, done: make(chan struct{})}
+	b.mu.Lock()
+	b.runs[id] = r
+	b.mu.Unlock()
+	log.Printf("run %s started for %s: %s\n", id, submitter, strings.Join(args, " "))
+
+	var copying sync.WaitGroup
+	for _, stream := range []struct {
+		w *brokerStream
+		r io.Reader
+	}{{stdout, stdoutPipe}, {stderr, stderrPipe}} {
+		copying.Add(1)
+		go func(w *brokerStream, pipe io.Reader) {
+			defer copying.Done()
+			if _, err := io.Copy(w, pipe); err != nil {
+				// nobody receives the output anymore; stopping takes further output, which is discarded
+				r.stopOnce.Do(func() {
+					log.Printf("run %s lost its client: %s\n", id, err)
+					_ = cmd.Process.Signal(syscall.SIGTERM)
+				})
+				_, _ = io.Copy(ioutil.Discard, pipe)
+			}
+		}(stream.w, stream.r)
+	}
+	go func() {
+		// the pipes are read to their end before waiting, which closes them
+		copying.Wait()
+		cmd.Wait()
+		r.exitCode = cmd.ProcessState.ExitCode()
+		close(r.done)
+		log.Printf("run %s exited with %d\n", id, r.exitCode)
+	}()
+	return id, r, stdinW, nil
+}
+
+// forwardStdin writes the stdin messages of the client to the run until one without data,
+// or until the client is gone; both end the run's stdin
+func forwardStdin(r *bufio.Reader, stdin *os.File) {
+	defer stdin.Close()
+	dec := json.NewDecoder(r)
+	for {
+		var req brokerRequest
+		if err := dec.Decode(&req); err != nil || req.Op != "stdin" || len(req.Data) == 0 {
+			return
+		}
+		if _, err := stdin.Write(req.Data); err != nil {
+			// the run does not read its stdin anymore
+			return
+		}
+	}
+}
+
+// lookup returns the run of the submitter; the runs of others are unknown to it
+func (b *broker) lookup(submitter, id string) (*brokeredRun, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r, ok := b.runs[id]
+	if !ok || r.submitter != submitter {
+		return nil, errors.Errorf("unknown run '%s'", id)
+	}
+	return r, nil
+}
+
+// clientIdentity identifies the client of conn by the uid of its process on the Unix socket,
+// and by the subject of its certificate with TLS
+func clientIdentity(conn net.Conn) (string, error) {
+	switch c := conn.(type) {
+	case *net.UnixConn:
+		uid, err := unixPeerUID(c)
+		if err != nil {
+			return "", err
+		}
+		return "uid " + uid, nil
+	case *tls.Conn:
+		if err := c.Handshake(); err != nil {
+			return "", err
+		}
+		certs := c.ConnectionState().PeerCertificates
+		if len(certs) == 0 {
+			return "", errors.New("no client certificate")
+		}
+		return "certificate " + certs[0].Subject.String(), nil
+	default:
+		return "", errors.Errorf("cannot identify clients of %s connections", conn.LocalAddr().Network())
+	}
+}
+
+func (r *brokeredRun) status(id string) brokerMessage {
+	select {
+	case <-r.done:
+		exitCode := r.exitCode
+		return brokerMessage{ID: id, State: "exited", ExitCode: &exitCode}
+	default:
+		return brokerMessage{ID: id, State: "running"}
+	}
+}
+
+func (b *broker) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var mu sync.Mutex
+	enc := json.NewEncoder(conn)
+	reply := func(msg brokerMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(msg)
+	}
+	fail := func(err error) { reply(brokerMessage{Error: err.Error()}) }
+
+	submitter, err := clientIdentity(conn)
+	if err != nil {
+		fail(errors.Wrap(err, "cannot identify client"))
+		return
+	}
+
+	var req brokerRequest
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err == nil || len(line) > 0 {
+		err = json.Unmarshal(line, &req)
+	}
+	if err != nil {
+		fail(errors.Wrap(err, "invalid request"))
+		return
+	}
+
+	switch req.Op {
+	case "run":
+		id, r, stdin, err := b.start(submitter, req.Args,
+			&brokerStream{mu: &mu, enc: enc, stream: "stdout"},
+			&brokerStream{mu: &mu, enc: enc, stream: "stderr"})
+		if err != nil {
+			fail(err)
+			return
+		}
+		go forwardStdin(reader, stdin)
+		reply(brokerMessage{ID: id, State: "running"})
+		<-r.done
+		reply(r.status(id))
+	case "status":
+		r, err := b.lookup(submitter, req.ID)
+		if err != nil {
+			fail(err)
+			return
+		}
+		reply(r.status(req.ID))
+	case "cancel":
+		r, err := b.lookup(submitter, req.ID)
+		if err != nil {
+			fail(err)
+			return
+		}
+		// the run stops its container on SIGTERM
+		if err := r.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+			select {
+			case <-r.done:
+			default:
+				fail(err)
+				return
+			}
+		}
+		reply(r.status(req.ID))
+	default:
+		fail(errors.Errorf("unknown op '%s'", req.Op))
+	}
+}
+
+func (r *Runner) serve(cmd *cobra.Command, args []string) error {
+	// clients run with the broker's privileges, so without a policy they could run anything
+	policy, err := loadPolicy()
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return errors.Errorf("serve requires a policy file at %s", policyPath)
+	}
+	l, err := r.brokerListen()
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-sigCh:
+			l.Close()
+		case <-done:
+		}
+	}()
+
+	r.log.Printf("serving on %s\n", l.Addr())
+	b := &broker{runs: map[string]*brokeredRun{}}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if strings.Contains(err.Error(), "use of closed network connection") {
+				return nil
+			}
+			return err
+		}
+		go b.handle(conn)
+	}
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&cliOptions.serveSocket, "socket", "/run/runonce.sock", "Unix socket to listen on")
+	serveCmd.Flags().StringVar(&cliOptions.serveGroup, "socket-group", "", "group allowed to use the Unix socket, by default only the broker's own group")
+	serveCmd.Flags().StringVar(&cliOptions.serveListen, "listen", "", "listen on this TCP address with mutual TLS instead of the Unix socket")
+	rootCmd.AddCommand(serveCmd)
+}
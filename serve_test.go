@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestCheckBrokerArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{args: []string{"--image", "alpine", "echo", "hi"}},
+		{args: []string{"--image=alpine", "--memory-limit", "1Gi", "--", "--volume", "/:/host"}},
+		{args: []string{"-e", "A=1", "-eB=2", "--env", "--volume"}},
+		{args: []string{"-qv", "--image", "alpine"}},
+		{args: []string{"-vv", "--timestamps", "--image", "alpine"}},
+		{args: []string{"--volume", "/:/host"}, wantErr: true},
+		{args: []string{"--volume=/:/host"}, wantErr: true},
+		{args: []string{"--image", "alpine", "echo", "--bind-cwd=/"}, wantErr: true},
+		{args: []string{"--file-args"}, wantErr: true},
+		{args: []string{"-f", "job.yml"}, wantErr: true},
+		{args: []string{"-qf", "job.yml"}, wantErr: true},
+		{args: []string{"--no-such-flag"}, wantErr: true},
+		{args: []string{"--config", "/etc/shadow"}, wantErr: true},
+		{args: []string{"kill", "some-run"}, wantErr: true},
+		{args: []string{"-q", "history"}, wantErr: true},
+		{args: []string{"help"}, wantErr: true},
+		{args: []string{"--image", "alpine", "echo", "logs"}},
+		{args: []string{"--image", "alpine", "--", "stop"}},
+	}
+	for _, tt := range tests {
+		if err := checkBrokerArgs(tt.args); (err != nil) != tt.wantErr {
+			t.Errorf("checkBrokerArgs(%q) error = %v, want error %v", tt.args, err, tt.wantErr)
+		}
+	}
+}
+
+func TestClientIdentity(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only read on Linux")
+	}
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client, err := net.Dial("unix", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	id, err := clientIdentity(conn)
+	if want := "uid " + strconv.Itoa(os.Getuid()); err != nil || id != want {
+		t.Errorf("clientIdentity() = %q, %v, want %q", id, err, want)
+	}
+}
+
+func TestBrokerLookupSubmitter(t *testing.T) {
+	b := &broker{runs: map[string]*brokeredRun{"run1": {submitter: "uid 1000", done: make(chan struct{})}}}
+	if _, err := b.lookup("uid 1000", "run1"); err != nil {
+		t.Errorf("lookup by the submitter: %v", err)
+	}
+	if _, err := b.lookup("uid 1001", "run1"); err == nil {
+		t.Error("lookup by another client succeeded")
+	}
+}
+
+func TestBrokerStreamClientGone(t *testing.T) {
+	client, server := net.Pipe()
+	client.Close()
+	s := &brokerStream{mu: &sync.Mutex{}, enc: json.NewEncoder(server), id: "run1", stream: "stdout"}
+	if n, err := s.Write([]byte("output")); err == nil || n != 0 {
+		t.Errorf("Write() = %d, %v, want an error", n, err)
+	}
+}
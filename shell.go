@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"path"
+	"regexp"
+	"strings"
+
+	docker_cli "docker.io/go-docker"
+	"github.com/pkg/errors"
+)
+
+// shellPath is the shell --shell runs the arguments with
+const shellPath = "/bin/sh"
+
+// arguments only a shell makes sense of, operators and redirections or expansions,
+// and arguments that need no quoting
+var (
+	shellOperatorRegexp  = regexp.MustCompile(`^(\||\|\||&&|;|>|>>|<|2>&1)$`)
+	shellExpansionRegexp = regexp.MustCompile("\\$[{(A-Za-z_]|`")
+	shellPlainRegexp     = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+)
+
+// looksLikeShell also takes a single argument with spaces for a quoted command line
+func looksLikeShell(args []string) bool {
+	if len(args) == 1 && strings.Contains(strings.TrimSpace(args[0]), " ") {
+		return true
+	}
+	for _, arg := range args {
+		if shellOperatorRegexp.MatchString(arg) || shellExpansionRegexp.MatchString(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// shellQuote quotes an argument for sh unless it is plain
+func shellQuote(arg string) string {
+	if shellPlainRegexp.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// shellCommand returns the entrypoint and command running the arguments as one shell command line.
+// A single argument is the command line; of several, only the operators are left to the shell,
+// the others are quoted and reach the command as they were given.
+func shellCommand(args []string) ([]string, []string) {
+	if len(args) == 1 {
+		return []string{shellPath, "-c"}, args
+	}
+	words := make([]string, len(args))
+	for i, arg := range args {
+		if shellOperatorRegexp.MatchString(arg) {
+			words[i] = arg
+		} else {
+			words[i] = shellQuote(arg)
+		}
+	}
+	return []string{shellPath, "-c"}, []string{strings.Join(words, " ")}
+}
+
+func isShell(entrypoint []string) bool {
+	if len(entrypoint) == 0 {
+		return false
+	}
+	switch path.Base(entrypoint[0]) {
+	case "sh", "bash", "ash", "dash", "zsh":
+		return true
+	}
+	return false
+}
+
+// checkShellArgs verifies the created container has a shell for --shell, and otherwise warns if
+// the arguments look like a shell command line that the entrypoint will get as plain arguments
+func (r *Runner) checkShellArgs(ctx context.Context, docker *docker_cli.Client, containerId string, args []string) error {
+	if !r.shellWrap && !looksLikeShell(args) {
+		return nil
+	}
+	_, statErr := docker.ContainerStatPath(ctx, containerId, shellPath)
+	hasShell := statErr == nil
+	if r.shellWrap {
+		if !hasShell {
+			return errors.Errorf("--shell needs %s, which the image does not have", shellPath)
+		}
+		return nil
+	}
+
+	inspect, err := docker.ContainerInspect(ctx, containerId)
+	if err != nil {
+		return err
+	}
+	entrypoint := inspect.Config.Entrypoint
+	if isShell(entrypoint) || (len(entrypoint) == 0 && len(args) > 0 && isShell(args)) {
+		return nil
+	}
+	if !hasShell {
+		r.log.Printf("warning: the arguments look like a shell command line, but the image has no shell to run them\n")
+	} else if len(entrypoint) > 0 {
+		r.log.Printf("warning: the arguments look like a shell command line, but are passed as plain arguments to %s; use --shell to run them with sh -c\n", entrypoint[0])
+	} else {
+		r.log.Printf("warning: the arguments look like a shell command line, but are run without a shell; use --shell to run them with sh -c\n")
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.Flags().BoolVar(&cliOptions.shellWrap, "shell", false, "run the arguments with sh -c instead of the image's entrypoint; a single argument is the command line, "+
+		"of several only operators like | and && are left unquoted")
+}
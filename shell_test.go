@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLooksLikeShell(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{args: []string{"echo", "hi"}, want: false},
+		{args: []string{"echo hi | wc -c"}, want: true},
+		{args: []string{"  single  "}, want: false},
+		{args: []string{"make", "&&", "make", "install"}, want: true},
+		{args: []string{"cat", "<", "in.txt"}, want: true},
+		{args: []string{"echo", "$HOME"}, want: true},
+		{args: []string{"echo", "${HOME}"}, want: true},
+		{args: []string{"echo", "`id`"}, want: true},
+		{args: []string{"echo", "costs $5"}, want: false},
+		{args: []string{"grep", "a|b", "file"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := looksLikeShell(tt.args); got != tt.want {
+			t.Errorf("looksLikeShell(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		arg, want string
+	}{
+		{arg: "plain", want: "plain"},
+		{arg: "--name=a/b.txt", want: "--name=a/b.txt"},
+		{arg: "", want: "''"},
+		{arg: "two words", want: "'two words'"},
+		{arg: "$HOME", want: "'$HOME'"},
+		{arg: "it's", want: `'it'\''s'`},
+		{arg: "*.log", want: "'*.log'"},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.arg); got != tt.want {
+			t.Errorf("shellQuote(%q) = %q, want %q", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"echo $HOME | wc -c"}, want: "echo $HOME | wc -c"},
+		{args: []string{"echo", "a b", "|", "wc", "-w"}, want: "echo 'a b' | wc -w"},
+		{args: []string{"make", "&&", "make", "install", ">", "log.txt", "2>&1"}, want: "make && make install > log.txt 2>&1"},
+		{args: []string{"printf", "it's", ";", "true"}, want: `printf 'it'\''s' ; true`},
+		{args: []string{"echo", "$PATH", "`id`"}, want: "echo '$PATH' '`id`'"},
+	}
+	for _, tt := range tests {
+		entrypoint, cmd := shellCommand(tt.args)
+		if !reflect.DeepEqual(entrypoint, []string{shellPath, "-c"}) {
+			t.Errorf("shellCommand(%q) entrypoint = %q", tt.args, entrypoint)
+		}
+		if !reflect.DeepEqual(cmd, []string{tt.want}) {
+			t.Errorf("shellCommand(%q) = %q, want %q", tt.args, cmd, tt.want)
+		}
+	}
+}
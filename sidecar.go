@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/container"
+	"docker.io/go-docker/api/types/network"
+	"github.com/pkg/errors"
+)
+
+// sidecarSpec is a helper container started alongside the job
+type sidecarSpec struct {
+	image string
+	cmd   []string
+}
+
+// parseSidecar parses "image[:tag] [cmd...]"; without a command the image default is used
+func parseSidecar(s string) (sidecarSpec, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return sidecarSpec{}, errors.New("empty sidecar specification")
+	}
+	image := fields[0]
+	if !strings.Contains(image, ":") {
+		image += ":latest"
+	}
+	return sidecarSpec{image: image, cmd: fields[1:]}, nil
+}
+
+// startSidecars creates and starts the sidecars of the job container, sharing its network, volumes
+// and resource limits. The ids of all created sidecars are returned even on error, so they can be cleaned up.
+func (r *Runner) startSidecars(ctx context.Context, docker *docker_cli.Client, specs []sidecarSpec, runID, jobId string,
+	networkMode container.NetworkMode, resources container.Resources) ([]string, error) {
+
+	var ids []string
+	for _, spec := range specs {
+		// sidecars are labeled with the run but not the image, so they are never mistaken for the job itself
+		resp, err := r.createContainer(ctx, docker, spec.image, &container.Config{
+			Cmd:   spec.cmd,
+			Image: spec.image,
+			Labels: map[string]string{
+				labelManaged: "true",
+				labelRunID:   runID,
+				labelRole:    "sidecar",
+			},
+		}, &container.HostConfig{
+			NetworkMode:   networkMode,
+			VolumesFrom:   []string{jobId},
+			RestartPolicy: container.RestartPolicy{Name: "no"},
+			AutoRemove:    true,
+			Resources:     resources,
+		}, &network.NetworkingConfig{})
+		if err != nil {
+			return ids, errors.Wrap(err, spec.image)
+		}
+		ids = append(ids, resp.ID)
+
+		if err := docker.ContainerStart(ctx, resp.ID, docker_t.ContainerStartOptions{}); err != nil {
+			return ids, errors.Wrap(err, spec.image)
+		}
+		if r.verbosity >= verboseInfo {
+			r.log.Printf("sidecar %s started, container id = %s\n", spec.image, resp.ID)
+		}
+	}
+	return ids, nil
+}
+
+// removeContainers force-removes helper containers during cleanup
+func (r *Runner) removeContainers(docker *docker_cli.Client, ids []string) {
+	for _, id := range ids {
+		r.cleanupContainer(docker, id)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	docker_cli "docker.io/go-docker"
+	"github.com/pkg/errors"
+)
+
+// checkSlice validates --slice, which is passed as the cgroup parent and needs the systemd cgroup driver
+func (r *Runner) checkSlice(ctx context.Context, docker *docker_cli.Client) error {
+	if !strings.HasSuffix(r.cgroupSlice, ".slice") {
+		return errors.Errorf("invalid slice '%s', expected a name ending in .slice", r.cgroupSlice)
+	}
+	if r.cgroupParent != "" {
+		return errors.New("--slice and --cgroup-parent are mutually exclusive")
+	}
+	info, err := docker.Info(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot query cgroup driver")
+	}
+	if info.CgroupDriver != "systemd" {
+		return errors.Errorf("--slice requires the systemd cgroup driver, the daemon uses %s", info.CgroupDriver)
+	}
+	return nil
+}
+
+// inSlice reports whether this process already runs in the slice, e.g. in the scope created by runInScope
+func inSlice(slice string) bool {
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	return err == nil && strings.Contains(string(data), "/"+slice+"/")
+}
+
+// runInScope re-executes docker-runonce in a transient systemd scope of the slice, so that
+// it is accounted together with its container; it reports false if it did not
+func (r *Runner) runInScope(args []string) (bool, error) {
+	if !r.hostUsesCgroupV2() || inSlice(r.cgroupSlice) {
+		return false, nil
+	}
+	systemdRun, err := exec.LookPath("systemd-run")
+	if err != nil {
+		r.log.Println("systemd-run not found, not running in a scope of the slice")
+		return false, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return false, err
+	}
+
+	scopeArgs := []string{"--scope", "--quiet", "--collect", "--slice=" + r.cgroupSlice}
+	c := exec.Command(systemdRun, append(append(scopeArgs, "--", exe), r.childArgs(nil, args)...)...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	if err := c.Start(); err != nil {
+		return true, errors.Wrap(err, "cannot start scope")
+	}
+	// a terminal's SIGINT already reaches the scope through the process group
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				if sig == syscall.SIGTERM {
+					c.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	c.Wait()
+	if code := c.ProcessState.ExitCode(); code != 0 {
+		return true, &exitCodeError{code: code}
+	}
+	return true, nil
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.cgroupSlice, "slice", "", "systemd slice to run the container in, e.g. runonce.slice")
+	rootCmd.Flags().BoolVar(&cliOptions.sliceScope, "slice-scope", false, "on cgroup v2 hosts, also run docker-runonce itself in a transient scope of the slice (root only)")
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// sleepSplay waits a random time of up to --splay, so runs started at the same time spread out;
+// interactive runs start at once
+func (r *Runner) sleepSplay(ctx context.Context) error {
+	if r.splay <= 0 || isTerminal(os.Stdin) {
+		return nil
+	}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(os.Getpid())))
+	delay := time.Duration(rnd.Int63n(int64(r.splay)))
+	if r.verbosity >= verboseInfo {
+		r.log.Printf("splay: waiting %s\n", r.formatDuration(delay))
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func init() {
+	rootCmd.Flags().DurationVar(&cliOptions.splay, "splay", 0, "wait a random time of up to this long before starting, unless stdin is a terminal")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+)
+
+// containerStats fetches a single stats sample for the container
+func containerStats(ctx context.Context, docker *docker_cli.Client, containerId string) (*docker_t.StatsJSON, error) {
+	resp, err := docker.ContainerStats(ctx, containerId, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var stats docker_t.StatsJSON
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// runHeartbeat logs a progress line every interval until ctx is done
+func (r *Runner) runHeartbeat(ctx context.Context, docker *docker_cli.Client, containerId string, interval time.Duration) {
+	started := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			elapsed := time.Since(started)
+			if stats, err := containerStats(ctx, docker, containerId); err == nil {
+				r.log.Printf("still running (elapsed %s, mem %s)\n", r.formatDuration(elapsed), r.formatBytes(stats.MemoryStats.Usage))
+			} else {
+				r.log.Printf("still running (elapsed %s)\n", r.formatDuration(elapsed))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// cpuTimePollInterval is how often the CPU time budget is checked
+const cpuTimePollInterval = 2 * time.Second
+
+// watchCPUTime kills the container once its cumulative CPU time reaches limit
+func (r *Runner) watchCPUTime(ctx context.Context, docker *docker_cli.Client, containerId string, limit time.Duration, result *runResult) {
+	ticker := time.NewTicker(cpuTimePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			stats, err := containerStats(ctx, docker, containerId)
+			if err != nil {
+				continue
+			}
+			if used := time.Duration(stats.CPUStats.CPUUsage.TotalUsage); used >= limit {
+				r.log.Printf("cpu time limit of %s exceeded (used %s), killing container\n", r.formatDuration(limit), r.formatDuration(used))
+				result.markCPUTimeExceeded()
+				r.runEvents.emit(runEvent{Event: "cpu-time-exceeded", ContainerID: containerId})
+				if err := docker.ContainerKill(ctx, containerId, "KILL"); err != nil {
+					r.log.Printf("cannot kill container: %v\n", err)
+				}
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	docker_t "docker.io/go-docker/api/types"
+)
+
+// stdin is copied in chunks of stdinChunkSize, reading at most stdinBuffers chunks ahead of the
+// container; once they are full, reading stdin waits for the container to take its input
+const (
+	stdinChunkSize = 256 * 1024
+	stdinBuffers   = 8
+)
+
+// stdinCopy forwards stdin to the attach connection through a bounded read-ahead buffer,
+// keeping track of the flow so that a stalled or refused input shows up
+type stdinCopy struct {
+	hr     docker_t.HijackedResponse
+	run    *Runner // whose stdin is copied, logged with its logger and units
+	chunks chan []byte
+	free   chan []byte
+	done   chan struct{}
+
+	mu       sync.Mutex
+	sent     uint64
+	writing  time.Time // start of the pending write, zero if none
+	complete bool
+	err      error
+}
+
+// startStdinCopy copies the container stdin to the attach connection, closing its write half once
+// the stdin is exhausted; with --stdin-progress, the amount of input sent is logged at its interval
+func (r *Runner) startStdinCopy(hr docker_t.HijackedResponse) *stdinCopy {
+	c := &stdinCopy{
+		hr:     hr,
+		run:    r,
+		chunks: make(chan []byte, stdinBuffers),
+		free:   make(chan []byte, stdinBuffers+1),
+		done:   make(chan struct{}),
+	}
+	go c.read(r.containerStdin)
+	go c.write()
+	if r.stdinProgress > 0 {
+		go c.reportProgress(r.stdinProgress)
+	}
+	return c
+}
+
+func (c *stdinCopy) read(r io.Reader) {
+	defer close(c.chunks)
+	for {
+		var buf []byte
+		select {
+		case buf = <-c.free:
+		default:
+			buf = make([]byte, stdinChunkSize)
+		}
+		// a plain Read, so that interactive input is forwarded as soon as it is typed
+		n, err := r.Read(buf)
+		if n > 0 {
+			select {
+			case c.chunks <- buf[:n]:
+			case <-c.done:
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				c.run.log.Printf("cannot read stdin: %v\n", err)
+			}
+			return
+		}
+	}
+}
+
+func (c *stdinCopy) write() {
+	defer close(c.done)
+	for chunk := range c.chunks {
+		c.mu.Lock()
+		c.writing = time.Now()
+		c.mu.Unlock()
+		n, err := c.hr.Conn.Write(chunk)
+		c.mu.Lock()
+		c.writing = time.Time{}
+		c.sent += uint64(n)
+		c.err = err
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+		select {
+		case c.free <- chunk[:cap(chunk)]:
+		default:
+		}
+	}
+	c.mu.Lock()
+	c.complete = true
+	c.mu.Unlock()
+	// like the docker cli, the end of the input is signalled by closing the write half
+	_ = c.hr.CloseWrite()
+}
+
+// unfinished describes the input the container did not take before closing its stdin or exiting;
+// a copy still waiting for more stdin counts as finished, the container just did not ask for more
+func (c *stdinCopy) unfinished() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.complete || (c.err == nil && c.writing.IsZero() && len(c.chunks) == 0) {
+		return "", false
+	}
+	return "container closed stdin after taking " + c.run.formatBytes(c.sent) + ", the rest of the input was not sent", true
+}
+
+// reportProgress logs the amount of input sent every interval until the copy ends
+func (c *stdinCopy) reportProgress(interval time.Duration) {
+	started := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastSent uint64
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			sent, writing := c.sent, c.writing
+			c.mu.Unlock()
+			rate := uint64(float64(sent-lastSent) / interval.Seconds())
+			lastSent = sent
+			if !writing.IsZero() && time.Since(writing) >= interval {
+				c.run.log.Printf("stdin: %s sent, waiting %s for the container to read, %d/%d buffers full\n",
+					c.run.formatBytes(sent), c.run.formatDuration(time.Since(writing)), len(c.chunks), stdinBuffers)
+			} else {
+				c.run.log.Printf("stdin: %s sent, %s/s, %d/%d buffers full\n",
+					c.run.formatBytes(sent), c.run.formatBytes(rate), len(c.chunks), stdinBuffers)
+			}
+		case <-c.done:
+			c.mu.Lock()
+			sent, complete := c.sent, c.complete
+			c.mu.Unlock()
+			if complete {
+				c.run.log.Printf("stdin: %s sent in %s\n", c.run.formatBytes(sent), c.run.formatDuration(time.Since(started)))
+			} else {
+				c.run.log.Printf("stdin: container closed stdin after taking %s\n", c.run.formatBytes(sent))
+			}
+			return
+		}
+	}
+}
+
+func init() {
+	rootCmd.Flags().DurationVar(&cliOptions.stdinProgress, "stdin-progress", 0, "log the progress of copying stdin to the container at this interval")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// stdioConn returns the connection serving the container's stdio: the one accepted with
+// --stdin-listen or passed by systemd socket activation, or nil
+func (r *Runner) stdioConn(ctx context.Context) (net.Conn, error) {
+	if r.stdinListen != "" {
+		return r.acceptStdinConn(ctx, r.stdinListen)
+	}
+	return activatedConn()
+}
+
+// acceptStdinConn listens on unix:/path or tcp:host:port and returns the first connection;
+// the wait ends when ctx is done
+func (r *Runner) acceptStdinConn(ctx context.Context, spec string) (net.Conn, error) {
+	var network, addr string
+	switch {
+	case strings.HasPrefix(spec, "unix:"):
+		network, addr = "unix", strings.TrimPrefix(spec, "unix:")
+		if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	case strings.HasPrefix(spec, "tcp:"):
+		network, addr = "tcp", strings.TrimPrefix(spec, "tcp:")
+	default:
+		return nil, errors.Errorf("invalid --stdin-listen '%s', expected unix:/path or tcp:host:port", spec)
+	}
+
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	// a single connection is served, the listener is not needed beyond it
+	defer l.Close()
+	if r.verbosity >= verboseInfo {
+		r.log.Printf("waiting for a connection on %s\n", l.Addr())
+	}
+	accepted := make(chan struct{})
+	defer close(accepted)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-accepted:
+		}
+	}()
+	conn, err := l.Accept()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if r.verbosity >= verboseInfo {
+		r.log.Printf("accepted connection from %s\n", conn.RemoteAddr())
+	}
+	return conn, nil
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.stdinListen, "stdin-listen", "", "serve the container's stdin and stdout over the first connection to unix:/path or tcp:host:port")
+}
@@ -0,0 +1,38 @@
+package main
+
+import "os"
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// interactiveOutput reports whether stdout and stderr are terminals, unless overridden with --no-tty or --force-tty
+func (r *Runner) interactiveOutput() bool {
+	switch {
+	case r.forceTTY:
+		return true
+	case r.noTTY:
+		return false
+	}
+	return isTerminal(os.Stdout) && isTerminal(os.Stderr)
+}
+
+// autoColor decides on colors when --color was not given, following NO_COLOR and CLICOLOR(_FORCE)
+func (r *Runner) autoColor() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return true
+	}
+	if os.Getenv("CLICOLOR") == "0" {
+		return false
+	}
+	return r.interactiveOutput()
+}
+
+func init() {
+	rootCmd.Flags().BoolVar(&cliOptions.noTTY, "no-tty", false, "treat stdout and stderr as plain output even if they are terminals")
+	rootCmd.Flags().BoolVar(&cliOptions.forceTTY, "force-tty", false, "treat stdout and stderr as terminals even if they are not")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var timeoutDaysRegexp = regexp.MustCompile(`^(\d+)d(.*)$`)
+
+// parseTimeout accepts Go durations with an optional leading day count (1d12h);
+// "none" and 0 disable the deadline and yield 0
+func parseTimeout(value string) (time.Duration, error) {
+	if value == "none" || value == "0" {
+		return 0, nil
+	}
+	var days time.Duration
+	rest := value
+	if m := timeoutDaysRegexp.FindStringSubmatch(value); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid timeout '%s'", value)
+		}
+		days, rest = time.Duration(n)*24*time.Hour, m[2]
+	}
+	var d time.Duration
+	if rest != "" {
+		var err error
+		if d, err = time.ParseDuration(rest); err != nil {
+			return 0, errors.Errorf("invalid timeout '%s', expected a duration like 90s, 2h30m or 1d12h, or none", value)
+		}
+	}
+	if d < 0 {
+		return 0, errors.Errorf("invalid timeout '%s', must not be negative", value)
+	}
+	if d == 0 && days == 0 {
+		return 0, nil
+	}
+	return days + d, nil
+}
+
+// capTimeout limits timeout to max unless max is empty; no deadline counts as infinitely long
+func (r *Runner) capTimeout(timeout time.Duration, max string) (time.Duration, error) {
+	if max == "" {
+		return timeout, nil
+	}
+	maxTimeout, err := parseTimeout(max)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid timeout cap")
+	}
+	if maxTimeout > 0 && (timeout == 0 || timeout > maxTimeout) {
+		r.log.Printf("run timeout capped to %s by image label\n", r.formatDuration(maxTimeout))
+		return maxTimeout, nil
+	}
+	return timeout, nil
+}
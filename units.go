@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// formatBytes formats a size for messages: IEC units, or exact bytes with --raw-units
+func (r *Runner) formatBytes(n uint64) string {
+	if r.rawUnits {
+		return strconv.FormatUint(n, 10)
+	}
+	return humanize.IBytes(n)
+}
+
+// formatDuration formats a duration for messages: rounded to a readable precision,
+// or exact seconds with --raw-units
+func (r *Runner) formatDuration(d time.Duration) string {
+	switch {
+	case r.rawUnits:
+		return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+	case d >= time.Minute:
+		return d.Round(time.Second).String()
+	case d >= time.Second:
+		return d.Round(100 * time.Millisecond).String()
+	default:
+		return d.Round(time.Millisecond).String()
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&cliOptions.rawUnits, "raw-units", false, "print sizes in bytes and durations in seconds instead of human-readable units")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	docker_cli "docker.io/go-docker"
+	docker_t "docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/container"
+	"github.com/pkg/errors"
+)
+
+// containerUsernsMode maps --userns to the host config; private is the daemon's default
+func (r *Runner) containerUsernsMode() (container.UsernsMode, error) {
+	switch r.usernsMode {
+	case "", "private":
+		return "", nil
+	case "host":
+		return "host", nil
+	}
+	return "", errors.Errorf("invalid --userns value '%s', expected host or private", r.usernsMode)
+}
+
+// remapsUsers reports whether the daemon of the info runs with userns-remap
+func remapsUsers(info *docker_t.Info) bool {
+	for _, opt := range info.SecurityOptions {
+		if strings.Contains(opt, "name=userns") {
+			return true
+		}
+	}
+	return false
+}
+
+// warnRemappedBind explains why a bound directory is not writable on a remapped daemon,
+// unless it is writable for every user anyway; info is the daemon info of the run, which
+// is only fetched here if the run did not need it before
+func (r *Runner) warnRemappedBind(ctx context.Context, docker *docker_cli.Client, info *docker_t.Info, dir string) {
+	if stat, err := os.Stat(dir); err == nil && stat.Mode().Perm()&0002 != 0 {
+		return
+	}
+	if info.ID == "" {
+		fetched, err := docker.Info(ctx)
+		if err != nil {
+			return
+		}
+		*info = fetched
+	}
+	if !remapsUsers(info) {
+		return
+	}
+	r.log.Println("the daemon remaps user namespaces: the container's root is an unprivileged host user " +
+		"and cannot write to the bound working directory unless it is writable for that user; " +
+		"use --userns host to run in the host's user namespace")
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.usernsMode, "userns", "private", "user namespace: private (the daemon's default, remapped if configured) or host")
+}
@@ -0,0 +1,47 @@
+package main
+
+import "strings"
+
+// createWarning is a warning of the daemon about the container configuration
+type createWarning struct {
+	Message string `json:"message"`
+	Kind    string `json:"kind,omitempty"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// knownWarnings classifies daemon warnings by a distinctive part of their message
+var knownWarnings = []struct {
+	match string
+	kind  string
+	hint  string
+}{
+	{"Memory limited without swap", "swap-limit-unsupported",
+		"enable swap accounting (swapaccount=1 on the kernel command line) or pass --memory-swap -1"},
+	{"OOM killer is disabled for the container, but no memory limit is set", "oom-kill-disable-without-limit",
+		"set a memory limit with --memory-limit"},
+	{"memory limit capabilities", "memory-limit-unsupported",
+		"the daemon's host lacks the memory cgroup, the memory limit is not enforced"},
+	{"memory swappiness", "swappiness-unsupported",
+		"the daemon's host does not support --memory-swappiness, omit it"},
+	{"memory soft limit", "memory-reservation-unsupported",
+		"the daemon's host does not support --memory-reservation, omit it"},
+	{"CPU cfs", "cpu-quota-unsupported",
+		"the daemon's host lacks CPU quota support, the --cpus limit is not enforced"},
+	{"does not match the detected host platform", "platform-mismatch",
+		"pull the image for the daemon's platform"},
+}
+
+func classifyWarning(message string) createWarning {
+	w := createWarning{Message: message}
+	for _, k := range knownWarnings {
+		if strings.Contains(message, k.match) {
+			w.Kind, w.Hint = k.kind, k.hint
+			break
+		}
+	}
+	return w
+}
+
+func init() {
+	rootCmd.Flags().BoolVar(&cliOptions.failOnWarnings, "fail-on-warnings", false, "fail the run if the daemon warns about the container configuration")
+}
@@ -0,0 +1,28 @@
+package main
+
+import "strings"
+
+// wasmPlatform is the image platform of wasm job modules
+const wasmPlatform = "wasi/wasm"
+
+// wasmRuntimes maps short names to the containerd wasm shims
+var wasmRuntimes = map[string]string{
+	"wasmtime": "io.containerd.wasmtime.v1",
+	"wasmedge": "io.containerd.wasmedge.v1",
+	"wasmer":   "io.containerd.wasmer.v1",
+	"spin":     "io.containerd.spin.v2",
+	"slight":   "io.containerd.slight.v1",
+}
+
+// resolveRuntime expands the short name of a wasm shim and reports whether the runtime runs wasm modules
+func resolveRuntime(name string) (string, bool) {
+	if shim, ok := wasmRuntimes[name]; ok {
+		return shim, true
+	}
+	for _, shim := range wasmRuntimes {
+		if name == shim {
+			return name, true
+		}
+	}
+	return name, strings.HasPrefix(name, "io.containerd.") && strings.Contains(name, "wasm")
+}
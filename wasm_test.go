@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestResolveRuntime(t *testing.T) {
+	tests := []struct {
+		name     string
+		want     string
+		wantWasm bool
+	}{
+		{name: "wasmtime", want: "io.containerd.wasmtime.v1", wantWasm: true},
+		{name: "spin", want: "io.containerd.spin.v2", wantWasm: true},
+		{name: "io.containerd.wasmedge.v1", want: "io.containerd.wasmedge.v1", wantWasm: true},
+		{name: "io.containerd.wasmtime.v2", want: "io.containerd.wasmtime.v2", wantWasm: true},
+		{name: "io.containerd.runc.v2", want: "io.containerd.runc.v2", wantWasm: false},
+		{name: "runsc", want: "runsc", wantWasm: false},
+		{name: "wasm", want: "wasm", wantWasm: false},
+		{name: "", want: "", wantWasm: false},
+	}
+	for _, tt := range tests {
+		got, wasm := resolveRuntime(tt.name)
+		if got != tt.want || wasm != tt.wantWasm {
+			t.Errorf("resolveRuntime(%q) = %q, %v, want %q, %v", tt.name, got, wasm, tt.want, tt.wantWasm)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"docker.io/go-docker/api/types/container"
+	"github.com/pkg/errors"
+)
+
+// windowsBindCwd replaces the default --bind-cwd target for Windows containers
+const windowsBindCwd = `C:\host`
+
+// containerIsolation maps --isolation, which only Windows daemons support beyond the default
+func (r *Runner) containerIsolation(windowsDaemon bool) (container.Isolation, error) {
+	switch iso := container.Isolation(r.isolation); iso {
+	case "", container.IsolationDefault:
+		return container.IsolationEmpty, nil
+	case container.IsolationProcess, container.IsolationHyperV:
+		if !windowsDaemon {
+			return "", errors.Errorf("--isolation %s requires a Windows daemon", r.isolation)
+		}
+		return iso, nil
+	}
+	return "", errors.Errorf("invalid --isolation value '%s', expected process or hyperv", r.isolation)
+}
+
+// adaptForWindows clears the Linux-only settings a Windows daemon rejects
+func adaptForWindows(hostConfig *container.HostConfig) {
+	hostConfig.OomScoreAdj = 0
+	hostConfig.ShmSize = 0
+	hostConfig.Sysctls = nil
+	hostConfig.Resources.PidsLimit = 0
+	hostConfig.Resources.OomKillDisable = nil
+	hostConfig.Resources.MemorySwappiness = nil
+	hostConfig.Resources.MemorySwap = 0
+	hostConfig.Resources.MemoryReservation = 0
+	hostConfig.Resources.CgroupParent = ""
+	hostConfig.Resources.BlkioWeight = 0
+}
+
+// bindSource returns the host part of a host:container[:mode] bind, allowing for drive letters (C:\)
+func bindSource(bind string) string {
+	start := 0
+	if len(bind) >= 3 && bind[1] == ':' && bind[2] == '\\' && bind[0]|0x20 >= 'a' && bind[0]|0x20 <= 'z' {
+		start = 2
+	}
+	for i := start; i < len(bind); i++ {
+		if bind[i] == ':' {
+			return bind[:i]
+		}
+	}
+	return bind
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.isolation, "isolation", "", "container isolation on Windows daemons: process or hyperv")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// timeWindow is a daily time range in a location; it spans midnight if it ends before it starts
+type timeWindow struct {
+	start, end time.Duration
+	loc        *time.Location
+}
+
+// parseWindow parses "22:00-06:00" or "22:00-06:00 Europe/Berlin"; without a zone the local one applies
+func parseWindow(spec string) (*timeWindow, error) {
+	fields := strings.Fields(spec)
+	if len(fields) < 1 || len(fields) > 2 {
+		return nil, errors.New("expected HH:MM-HH:MM, optionally followed by a time zone")
+	}
+	w := &timeWindow{loc: time.Local}
+	if len(fields) == 2 {
+		loc, err := time.LoadLocation(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		w.loc = loc
+	}
+	bounds := strings.SplitN(fields[0], "-", 2)
+	if len(bounds) != 2 {
+		return nil, errors.New("expected HH:MM-HH:MM")
+	}
+	for i, b := range bounds {
+		var h, m int
+		if n, err := fmt.Sscanf(b, "%d:%d", &h, &m); err != nil || n != 2 || h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m != 0) {
+			return nil, errors.Errorf("invalid time '%s'", b)
+		}
+		d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute
+		if i == 0 {
+			w.start = d
+		} else {
+			w.end = d
+		}
+	}
+	return w, nil
+}
+
+// sinceMidnight is the wall clock time of t in the window's location
+func (w *timeWindow) sinceMidnight(t time.Time) time.Duration {
+	t = t.In(w.loc)
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+func (w *timeWindow) contains(t time.Time) bool {
+	d := w.sinceMidnight(t)
+	switch {
+	case w.start == w.end:
+		return true
+	case w.start < w.end:
+		return d >= w.start && d < w.end
+	default:
+		return d >= w.start || d < w.end
+	}
+}
+
+// nextStart is when the window opens next after t
+func (w *timeWindow) nextStart(t time.Time) time.Time {
+	t = t.In(w.loc)
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, w.loc).Add(w.start)
+	if !start.After(t) {
+		start = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, w.loc).Add(w.start)
+	}
+	return start
+}
+
+// checkWindow refuses a run outside the --window, or with --window-wait waits for it to open
+func (r *Runner) checkWindow(ctx context.Context, spec string) error {
+	w, err := parseWindow(spec)
+	if err != nil {
+		return errors.Wrapf(err, "invalid window '%s'", spec)
+	}
+	now := time.Now()
+	if w.contains(now) {
+		return nil
+	}
+	next := w.nextStart(now)
+	if !r.windowWait {
+		return errors.Wrapf(ErrOutsideWindow, "window %s opens at %s", spec, next.Format(time.RFC3339))
+	}
+	r.log.Printf("waiting until %s for window %s\n", next.Format(time.RFC3339), spec)
+	select {
+	case <-time.After(time.Until(next)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.runWindow, "window", "", "only run within this daily time window, e.g. \"22:00-06:00\" or \"22:00-06:00 Europe/Berlin\"")
+	rootCmd.Flags().BoolVar(&cliOptions.windowWait, "window-wait", false, "wait for the --window to open instead of failing")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+
+	docker_cli "docker.io/go-docker"
+	volumetypes "docker.io/go-docker/api/types/volume"
+	"github.com/pkg/errors"
+)
+
+// createWorkspace creates a volume labeled with the run, so leftovers can be traced to it
+func createWorkspace(ctx context.Context, docker *docker_cli.Client, name, runID string) (string, error) {
+	vol, err := docker.VolumeCreate(ctx, volumetypes.VolumesCreateBody{
+		Name:   name,
+		Labels: map[string]string{labelManaged: "true", labelRunID: runID},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "cannot create workspace volume")
+	}
+	return vol.Name, nil
+}
+
+func (r *Runner) removeWorkspace(docker *docker_cli.Client, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cleanupTimeout)
+	defer cancel()
+	if err := docker.VolumeRemove(ctx, name, true); err != nil {
+		r.log.Printf("cannot remove workspace volume %s: %v\n", name, err)
+	}
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&cliOptions.workspacePath, "workspace", "", "mount a scratch volume at this path, removed with the container")
+}